@@ -0,0 +1,69 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+)
+
+// fieldByName returns a structField with the given column name.
+func (p *Patcher) fieldByName(name string) (*structField, bool) {
+	for _, f := range p.sorted {
+		if f.name == name && p.visible(f) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// fieldByIndex returns a structField with the given struct field index.
+func (p *Patcher) fieldByIndex(index int) *structField {
+	for _, f := range p.sorted {
+		if f.index == index {
+			return f
+		}
+	}
+	return nil
+}
+
+// apply sets values of the given fields to the struct dst.
+func (p *Patcher) apply(dst reflect.Value, f Fields) error {
+	if dst.Type() != p.typ {
+		return errors.New("patch: cannot apply to " + dst.Type().String())
+	}
+	for _, data := range f {
+		sf, ok := p.fieldByName(data.Key)
+		if !ok {
+			return &ParseError{err: errUnexpectedField, Key: data.Key}
+		}
+		fv := dst.Field(sf.index)
+		if data.Value == nil {
+			fv.Set(reflect.Zero(sf.typ))
+			continue
+		}
+		v := reflect.ValueOf(data.Value)
+		if !v.Type().AssignableTo(sf.typ) {
+			return &ParseError{
+				err:    errUnmarshalField,
+				Key:    data.Key,
+				detail: v.Type().String() + " is not assignable to " + sf.typ.String(),
+			}
+		}
+		fv.Set(v)
+	}
+	return nil
+}
+
+// diff returns fields of b whose values differ from a.
+func (p *Patcher) diff(a, b reflect.Value) Fields {
+	var f Fields
+	for _, sf := range p.sorted {
+		if !p.visible(sf) {
+			continue
+		}
+		v := b.Field(sf.index).Interface()
+		if !reflect.DeepEqual(a.Field(sf.index).Interface(), v) {
+			f = append(f, Field{sf.name, v, sf.index})
+		}
+	}
+	return f
+}
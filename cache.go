@@ -0,0 +1,81 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// structInfo is a compiled field table of a struct type.
+type structInfo struct {
+	// fields keyed by JSON property name
+	fields map[string]*structField
+	// fields in order of struct field index
+	sorted []*structField
+	// fields keyed by their aliases
+	aliases map[string]*structField
+	// properties keyed by integer map keys of CBOR input
+	cborKeys map[int64]string
+	problems []string
+}
+
+// structCache caches *structInfo by reflect.Type so that New doesn't walk the
+// same struct type twice.
+var structCache sync.Map
+
+// cachedStruct returns the compiled field table of typ.
+func cachedStruct(typ reflect.Type) *structInfo {
+	if v, ok := structCache.Load(typ); ok {
+		return v.(*structInfo)
+	}
+	v, _ := structCache.LoadOrStore(typ, parseStruct(typ))
+	return v.(*structInfo)
+}
+
+// DecodeFunc decodes the raw value of the JSON property prop with decode, which
+// decodes the raw value into the given pointer like json.Unmarshal does.
+// cmd/patchgen generates DecodeFunc for a struct type so that Patcher doesn't
+// rely on reflection to allocate field values.
+type DecodeFunc func(prop string, decode func(v interface{}) error) (interface{}, error)
+
+// decoders holds DecodeFunc registered by Register.
+var decoders sync.Map
+
+// errProbe stops a DecodeFunc that Register probes.
+var errProbe = errors.New("probe")
+
+// Register registers fn as the DecodeFunc for the struct type of src.
+// It is usually called from code generated by cmd/patchgen. It panics when fn
+// doesn't decode every property to the type of its struct field, which
+// happens when the generated code is stale after the struct changed.
+func Register(src interface{}, fn DecodeFunc) {
+	typ, err := structType(src)
+	if err != nil {
+		panic(err.Error())
+	}
+	for _, f := range cachedStruct(typ).sorted {
+		var got reflect.Type
+		fn(f.prop, func(v interface{}) error {
+			if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+				got = t.Elem()
+			}
+			return errProbe
+		})
+		if got != f.typ {
+			detail := "doesn't decode property '" + f.prop + "'"
+			if got != nil {
+				detail = "decodes property '" + f.prop + "' to " + got.String() + ", want " + f.typ.String()
+			}
+			panic("patch: DecodeFunc of " + typ.String() + " " + detail + "; regenerate it with patchgen")
+		}
+	}
+	decoders.Store(typ, fn)
+}
+
+// lookupDecoder returns a registered DecodeFunc for typ.
+func lookupDecoder(typ reflect.Type) DecodeFunc {
+	if v, ok := decoders.Load(typ); ok {
+		return v.(DecodeFunc)
+	}
+	return nil
+}
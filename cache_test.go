@@ -0,0 +1,103 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type benchUser struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email" patch:"email_address"`
+	Active  bool      `json:"active"`
+	Day     Weekday   `json:"day"`
+	Days    []Weekday `json:"days"`
+	Profile string    `json:"profile"`
+	Age     *int      `json:"age"`
+}
+
+func TestCachedStruct(t *testing.T) {
+	var wg sync.WaitGroup
+	patchers := make([]*Patcher, 10)
+	for i := range patchers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patchers[i] = New(benchUser{})
+		}(i)
+	}
+	wg.Wait()
+	for i, p := range patchers {
+		if len(p.fields) != 8 {
+			t.Fatal(i, ": unexpected fields: ", p.fields)
+		}
+		// the same compiled field table should be shared
+		if p.fields["id"] != patchers[0].fields["id"] {
+			t.Fatal(i, ": should share compiled fields")
+		}
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		New(benchUser{})
+	}
+}
+
+func BenchmarkNewUncached(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		typ, _ := structType(benchUser{})
+		parseStruct(typ)
+	}
+}
+
+func TestRegisterStale(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	decodeAs := func(name interface{}) DecodeFunc {
+		return func(prop string, decode func(v interface{}) error) (interface{}, error) {
+			switch prop {
+			case "id":
+				var v int
+				err := decode(&v)
+				return v, err
+			case "name":
+				if name == nil {
+					break
+				}
+				v := reflect.New(reflect.TypeOf(name))
+				err := decode(v.Interface())
+				return v.Elem().Interface(), err
+			}
+			return nil, errors.New("unknown property " + prop)
+		}
+	}
+	testCases := []struct {
+		name interface{}
+		msg  string
+	}{
+		{0, "patch: DecodeFunc of patch.item decodes property 'name' to int, want string; regenerate it with patchgen"},
+		{nil, "patch: DecodeFunc of patch.item doesn't decode property 'name'; regenerate it with patchgen"},
+	}
+	for _, tc := range testCases {
+		func() {
+			defer func() {
+				if msg := recover(); msg != tc.msg {
+					t.Fatal("Unexpected panic: ", msg)
+				}
+			}()
+			Register(item{}, decodeAs(tc.name))
+		}()
+	}
+	if lookupDecoder(reflect.TypeOf(item{})) != nil {
+		t.Fatal("stale DecodeFunc should not be registered")
+	}
+	Register(item{}, decodeAs(""))
+	if lookupDecoder(reflect.TypeOf(item{})) == nil {
+		t.Fatal("DecodeFunc should be registered")
+	}
+}
@@ -0,0 +1,365 @@
+// Package cbor decodes CBOR input for github.com/smagch/patch.
+//
+// The top-level value must be a map. Integer map keys are matched to fields
+// declaring the same key with the cbor option of patch tag, like
+// `patch:",cbor=3"`, and other integer keys are treated as unknown
+// properties of their decimal strings. Values are converted to field types
+// through encoding/json. Byte strings are decoded to []byte fields and
+// date/time tags to time.Time fields.
+//
+// Limits of the Patcher apply as well, where each tag counts as a level of
+// nesting.
+package cbor
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/smagch/patch"
+	"github.com/smagch/patch/internal/bindec"
+)
+
+// Decoder is a patch.Decoder that reads a CBOR map.
+type Decoder struct {
+	buf []byte
+	// input byte offset
+	off int
+	// number of entries left in the map; -1 before reading the map header and
+	// -2 for an indefinite-length map
+	left int
+	// returns properties of integer map keys
+	keys   func(n int64) (string, bool)
+	limits bindec.Limits
+}
+
+// NewDecoder returns a Decoder reading b with the integer map keys and the
+// limits of p.
+func NewDecoder(b []byte, p *patch.Patcher) *Decoder {
+	return &Decoder{buf: b, left: -1, keys: p.CBORKey, limits: bindec.Limits{Limits: p.Limits()}}
+}
+
+// Unmarshal decodes CBOR input b to Fields with p.
+func Unmarshal(p *patch.Patcher, b []byte) (patch.Fields, error) {
+	return p.Parse(NewDecoder(b, p))
+}
+
+// UnmarshalResult is like Unmarshal but returns *patch.Result.
+func UnmarshalResult(p *patch.Patcher, b []byte) (*patch.Result, error) {
+	return p.ParseResult(NewDecoder(b, p))
+}
+
+// Next implements patch.Decoder.
+func (d *Decoder) Next() (string, error) {
+	if d.left == -1 {
+		if err := d.limits.Bytes(len(d.buf)); err != nil {
+			return "", err
+		}
+		major, info, n, err := d.head()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case major == 7 && (n == 22 || n == 23) && info < 24:
+			// null is regarded as an empty map like null in JSON.
+			d.left = 0
+		case major == 5 && info == 31:
+			d.left = -2
+		case major == 5:
+			if n > uint64(len(d.buf)) {
+				return "", bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+			}
+			d.left = int(n)
+		default:
+			return "", bindec.SyntaxError("input is not a CBOR map")
+		}
+	}
+	if d.left == 0 || d.left == -2 && d.isBreak() {
+		d.left = 0
+		if d.off != len(d.buf) {
+			return "", bindec.SyntaxError("invalid data after top-level value")
+		}
+		return "", io.EOF
+	}
+	if d.left > 0 {
+		d.left--
+	}
+	key, err := d.value(0)
+	if err != nil {
+		return "", err
+	}
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case uint64:
+		if k <= math.MaxInt64 {
+			if prop, ok := d.keys(int64(k)); ok {
+				return prop, nil
+			}
+		}
+		return strconv.FormatUint(k, 10), nil
+	case int64:
+		if prop, ok := d.keys(k); ok {
+			return prop, nil
+		}
+		return strconv.FormatInt(k, 10), nil
+	}
+	return "", bindec.SyntaxError("map key is neither a string nor an integer")
+}
+
+// Decode implements patch.Decoder.
+func (d *Decoder) Decode(v interface{}) error {
+	value, err := d.value(1)
+	if err != nil {
+		return err
+	}
+	return bindec.Convert(value, v)
+}
+
+// InputOffset returns the input byte offset of the current position.
+func (d *Decoder) InputOffset() int64 {
+	return int64(d.off)
+}
+
+// read returns the next n bytes.
+func (d *Decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.buf)-d.off) {
+		d.off = len(d.buf)
+		return nil, bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+	}
+	b := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// isBreak consumes the break stop code of indefinite-length items if it's
+// next.
+func (d *Decoder) isBreak() bool {
+	if d.off < len(d.buf) && d.buf[d.off] == 0xff {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// head reads the initial byte and the argument of a data item. info 31 means
+// indefinite length.
+func (d *Decoder) head() (major, info byte, n uint64, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info < 28:
+		b, err = d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+	case info == 31 && major >= 2 && major <= 5:
+	default:
+		return 0, 0, 0, bindec.SyntaxError("invalid initial byte 0x" + strconv.FormatUint(uint64(b[0]), 16))
+	}
+	return major, info, n, nil
+}
+
+// value reads the next data item nested at depth.
+func (d *Decoder) value(depth int) (interface{}, error) {
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return n, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, bindec.SyntaxError("integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		b, err := d.chunks(major, info, n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 2 {
+			return b, nil
+		}
+		if !utf8.Valid(b) {
+			return nil, bindec.SyntaxError("invalid UTF-8 text string")
+		}
+		if err := d.limits.String(depth, len(b)); err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4, 5:
+		if depth, err = d.limits.Nest(depth); err != nil {
+			return nil, err
+		}
+		if major == 4 {
+			return d.array(info, n, depth)
+		}
+		return d.mapValue(info, n, depth)
+	case 6:
+		// tags count toward depth as they nest the tagged item
+		if depth, err = d.limits.Nest(depth); err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		return d.tagged(n, v)
+	}
+	switch {
+	case info == 25:
+		return halfFloat(uint16(n)), nil
+	case info == 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case info == 27:
+		return math.Float64frombits(n), nil
+	case n == 20:
+		return false, nil
+	case n == 21:
+		return true, nil
+	case n == 22, n == 23:
+		return nil, nil
+	}
+	return nil, bindec.SyntaxError("unsupported simple value " + strconv.FormatUint(n, 10))
+}
+
+// chunks reads a byte or text string of n bytes, or chunks of an
+// indefinite-length string.
+func (d *Decoder) chunks(major, info byte, n uint64) ([]byte, error) {
+	if info != 31 {
+		b, err := d.read(n)
+		return append([]byte(nil), b...), err
+	}
+	var buf []byte
+	for !d.isBreak() {
+		m, i, n, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || i == 31 {
+			return nil, bindec.SyntaxError("invalid chunk of indefinite-length string")
+		}
+		b, err := d.read(n)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+// more reports whether an array or map has the i-th item.
+func (d *Decoder) more(info byte, n uint64, i uint64) bool {
+	if info == 31 {
+		return !d.isBreak()
+	}
+	return i < n
+}
+
+func (d *Decoder) array(info byte, n uint64, depth int) ([]interface{}, error) {
+	if info != 31 && n > uint64(len(d.buf)-d.off) {
+		return nil, bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+	}
+	a := []interface{}{}
+	for i := uint64(0); d.more(info, n, i); i++ {
+		v, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// mapValue reads a map whose keys are strings or integers. Integer keys are
+// converted to strings so that the map can be converted through
+// encoding/json.
+func (d *Decoder) mapValue(info byte, n uint64, depth int) (map[string]interface{}, error) {
+	if info != 31 && n > uint64(len(d.buf)-d.off) {
+		return nil, bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+	}
+	m := make(map[string]interface{})
+	for i := uint64(0); d.more(info, n, i); i++ {
+		k, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		switch k := k.(type) {
+		case string:
+			key = k
+		case uint64:
+			key = strconv.FormatUint(k, 10)
+		case int64:
+			key = strconv.FormatInt(k, 10)
+		default:
+			return nil, bindec.SyntaxError("map key is neither a string nor an integer")
+		}
+		if m[key], err = d.value(depth); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// tagged returns the value v with the tag number tag. Date/time tags are
+// converted to time.Time and other tags are ignored.
+func (d *Decoder) tagged(tag uint64, v interface{}) (interface{}, error) {
+	switch tag {
+	case 0:
+		s, ok := v.(string)
+		if !ok {
+			return nil, bindec.SyntaxError("date/time string is not a text string")
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, bindec.SyntaxError(err.Error())
+		}
+		return t, nil
+	case 1:
+		switch n := v.(type) {
+		case uint64:
+			return time.Unix(int64(n), 0).UTC(), nil
+		case int64:
+			return time.Unix(n, 0).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(n)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, bindec.SyntaxError("epoch time is not a number")
+	}
+	return v, nil
+}
+
+// halfFloat converts an IEEE 754 half-precision float to float64.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+0x400, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,128 @@
+package cbor
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smagch/patch"
+)
+
+type device struct {
+	ID      string         `json:"id" patch:",cbor=1"`
+	Temp    float64        `json:"temp" patch:",cbor=2"`
+	Battery *int           `json:"battery" patch:",cbor=3"`
+	Tags    []string       `json:"tags" patch:",cbor=-1"`
+	Seen    time.Time      `json:"seen"`
+	Raw     []byte         `json:"raw"`
+	Meta    map[string]int `json:"meta"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	p := patch.New(device{})
+	src := []byte{
+		0xa7,
+		0x01, 0x62, 'a', 'b',
+		0x02, 0xf9, 0x3e, 0x00,
+		0x03, 0x20,
+		0x20, 0x9f, 0x61, 'a', 0x61, 'b', 0xff,
+		0x64, 's', 'e', 'e', 'n', 0xc1, 0x1a, 0x4a, 0xf9, 0xf0, 0x70,
+		0x63, 'r', 'a', 'w', 0x42, 0x01, 0x02,
+		0x64, 'm', 'e', 't', 'a', 0xa1, 0x05, 0x06,
+	}
+	f, err := Unmarshal(p, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	battery := -1
+	seen := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	if keys := f.Keys(); !reflect.DeepEqual(keys, []string{"id", "temp", "battery", "tags", "seen", "raw", "meta"}) {
+		t.Fatal("Unexpected keys: ", keys)
+	}
+	expected := []interface{}{"ab", 1.5, &battery, []string{"a", "b"}, seen, []byte{1, 2}, map[string]int{"5": 6}}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+
+	seenString := append([]byte{0xa1, 0x64, 's', 'e', 'e', 'n', 0xc0, 0x74}, "2009-11-10T23:00:00Z"...)
+	f, err = Unmarshal(p, seenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := f.Get("seen"); v != seen {
+		t.Fatal("Unexpected time: ", v)
+	}
+	f, err = Unmarshal(p, []byte{0xbf, 0x01, 0x61, 'x', 0x03, 0xf6, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := f.Values(); !reflect.DeepEqual(values, []interface{}{"x", (*int)(nil)}) {
+		t.Fatal("Unexpected values: ", values)
+	}
+
+	res, err := UnmarshalResult(patch.New(device{}, patch.Unknown(patch.CollectUnknown)), []byte{0xa1, 0x09, 0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Extra["9"]) != "1" {
+		t.Fatal("Unexpected extra: ", res.Extra)
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	p := patch.New(device{})
+	cases := []struct {
+		src []byte
+		msg string
+	}{
+		{[]byte{0xf6}, "patch:input is empty"},
+		{[]byte{0xa0}, "patch:input is empty"},
+		{[]byte{0x81, 0x01}, "patch:invalid input format, input is not a CBOR map (offset 1)"},
+		{[]byte{0xa1, 0x01}, "patch:invalid input format on key 'id', unexpected EOF (offset 2)"},
+		{[]byte{0xbf, 0x01, 0x61, 'x'}, "patch:invalid input format, unexpected EOF (offset 4)"},
+		{[]byte{0xa1, 0x01, 0x61, 'x', 0x00}, "patch:invalid input format, invalid data after top-level value (offset 4)"},
+		{[]byte{0xa1, 0x41, 0x00, 0x01}, "patch:invalid input format, map key is neither a string nor an integer (offset 3)"},
+		{[]byte{0xa1, 0x01, 0x62, 0xff, 0xfe}, "patch:invalid input format on key 'id', invalid UTF-8 text string (offset 5)"},
+		{[]byte{0xa1, 0x01, 0x01}, "patch:cannot unmarshal field on key 'id', json: cannot unmarshal number into Go value of type string (offset 3)"},
+		{[]byte{0xa1, 0x09, 0x01}, "patch:unexpected field on key '9' (offset 2)"},
+	}
+	for _, c := range cases {
+		_, err := Unmarshal(p, c.src)
+		if _, ok := err.(*patch.ParseError); !ok || err.Error() != c.msg {
+			t.Fatalf("Unexpected error for % x: %v", c.src, err)
+		}
+	}
+	if _, err := Unmarshal(p, []byte{0x81, 0x01}); !errors.Is(err, patch.ErrInvalidFormat) {
+		t.Fatal("Unexpected error: ", err)
+	}
+
+	limited := []struct {
+		opt patch.Option
+		src []byte
+		err error
+	}{
+		{patch.MaxBytes(2), []byte{0xa1, 0x01, 0x60}, patch.ErrTooLarge},
+		{patch.MaxKeys(1), []byte{0xa2, 0x01, 0x60, 0x02, 0x00}, patch.ErrTooManyKeys},
+		{patch.MaxStringLength(1), []byte{0xa1, 0x01, 0x62, 'a', 'b'}, patch.ErrStringTooLong},
+		{patch.MaxDepth(1), []byte{0xa1, 0x20, 0x80}, patch.ErrTooDeep},
+		{patch.MaxDepth(2), []byte{0xa1, 0x20, 0xc6, 0xc6, 0x80}, patch.ErrTooDeep},
+		{patch.MaxDepth(0), append(append([]byte{0xa1, 0x01}, bytes.Repeat([]byte{0xc6}, 1<<20)...), 0x60), patch.ErrTooDeep},
+		{patch.MaxDepth(0), append(append([]byte{0xa1, 0x20}, bytes.Repeat([]byte{0x81}, 1<<20)...), 0x60), patch.ErrTooDeep},
+	}
+	for _, c := range limited {
+		_, err := Unmarshal(patch.New(device{}, c.opt), c.src)
+		if _, ok := err.(*patch.ParseError); !ok || !errors.Is(err, c.err) {
+			t.Fatalf("Unexpected error for % x: %v", c.src[:3], err)
+		}
+	}
+	f, err := Unmarshal(patch.New(device{}, patch.MaxStringLength(2)), []byte{0xa1, 0x64, 's', 'e', 'e', 'n', 0xc1, 0x01})
+	if err != nil || len(f) != 1 {
+		t.Fatal("property names should not be limited: ", f, err)
+	}
+	if !strings.HasPrefix(patch.ErrInvalidFormat.Error(), "invalid") {
+		t.Fatal("Unexpected message: ", patch.ErrInvalidFormat)
+	}
+}
@@ -0,0 +1,311 @@
+/*
+Command patchgen generates code that decodes JSON properties of struct types
+without reflection for github.com/smagch/patch.
+
+For each type given by -type, patchgen emits a patch.DecodeFunc that switches
+on the JSON property name and unmarshals the value into a variable of the
+field type, and registers it with patch.Register in an init function. Naming
+rules of the json and patch tags are the same as patch.New.
+
+Only allocation and decoding of field values are generated. The field table,
+key matching, options and SQL output of patch.Patcher stay driven by
+reflection, so both paths share the same behavior. patch.Register panics at
+init when the generated code is stale, e.g. a field type changed, so
+regenerate the code whenever the struct changes.
+
+Typical usage is a go:generate directive next to the struct definition:
+
+	//go:generate patchgen -type User,Article
+
+By default patchgen parses non-test Go files in the current directory and
+writes <type>_patch.go for the first type. Files given as arguments are parsed
+instead of the directory.
+*/
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output    = flag.String("output", "", "output file name; default <type>_patch.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: patchgen -type T [-output file] [files...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("patchgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		var err error
+		if files, err = packageFiles("."); err != nil {
+			log.Fatal(err)
+		}
+	}
+	types := strings.Split(*typeNames, ",")
+	src, err := generate(files, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = strings.ToLower(types[0]) + "_patch.go"
+	}
+	if err := ioutil.WriteFile(name, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// packageFiles returns non-test Go files in dir.
+func packageFiles(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range matches {
+		if !strings.HasSuffix(name, "_test.go") {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// field is a patchable struct field.
+type field struct {
+	// JSON property name
+	prop string
+	// Go type expression of the field
+	typ string
+}
+
+// generator holds the state of the output.
+type generator struct {
+	fset    *token.FileSet
+	buf     bytes.Buffer
+	imports map[string]string
+}
+
+// generate parses the given files and returns formatted source that
+// registers a DecodeFunc for each of the given types.
+func generate(files []string, types []string) ([]byte, error) {
+	g := &generator{
+		fset:    token.NewFileSet(),
+		imports: make(map[string]string),
+	}
+	var pkg string
+	specs := make(map[string]*ast.StructType)
+	fileImports := make(map[string]map[string]string)
+	for _, name := range files {
+		f, err := parser.ParseFile(g.fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg = f.Name.Name
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					specs[ts.Name.Name] = st
+					fileImports[ts.Name.Name] = importsOf(f)
+				}
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for _, name := range types {
+		st, ok := specs[name]
+		if !ok {
+			return nil, errors.New("struct type " + name + " is not found")
+		}
+		fields, err := g.structFields(st, fileImports[name])
+		if err != nil {
+			return nil, errors.New(name + ": " + err.Error())
+		}
+		writeDecoder(&body, name, fields)
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by patchgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&g.buf, "package %s\n\n", pkg)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	std := []string{"errors", "strconv"}
+	others := []string{"github.com/smagch/patch"}
+	for _, path := range paths {
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			others = append(others, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	fmt.Fprintf(&g.buf, "import (\n")
+	g.writeImports(std)
+	fmt.Fprintf(&g.buf, "\n")
+	g.writeImports(others)
+	fmt.Fprintf(&g.buf, ")\n\n")
+	g.buf.Write(body.Bytes())
+	return format.Source(g.buf.Bytes())
+}
+
+// writeImports writes import specs of the given paths.
+func (g *generator) writeImports(paths []string) {
+	for _, path := range paths {
+		if name, ok := g.imports[path]; ok && name != path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&g.buf, "\t%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(&g.buf, "\t%q\n", path)
+		}
+	}
+}
+
+// importsOf returns import paths of f keyed by their package names.
+func importsOf(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+// structFields returns patchable fields of st in order of struct field index.
+func (g *generator) structFields(st *ast.StructType, imports map[string]string) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(s)
+		}
+		names := make([]string, len(f.Names))
+		for i, ident := range f.Names {
+			names[i] = ident.Name
+		}
+		if len(names) == 0 {
+			names = []string{embeddedName(f.Type)}
+		}
+		var typ bytes.Buffer
+		if err := printer.Fprint(&typ, g.fset, f.Type); err != nil {
+			return nil, err
+		}
+		if err := g.addImports(f.Type, imports); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if prop, ok := propName(name, tag); ok {
+				fields = append(fields, field{prop, typ.String()})
+			}
+		}
+	}
+	return fields, nil
+}
+
+// addImports adds imports of packages that expr refers to.
+func (g *generator) addImports(expr ast.Expr, imports map[string]string) (err error) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			path, found := imports[ident.Name]
+			if !found {
+				err = errors.New("unknown package " + ident.Name)
+				return false
+			}
+			g.imports[path] = ident.Name
+		}
+		return false
+	})
+	return err
+}
+
+// embeddedName returns the field name of an embedded field.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// propName returns the JSON property name of a struct field in the same way
+// as patch.New.
+func propName(name string, tag reflect.StructTag) (string, bool) {
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		return "", false
+	}
+	prop := strings.Split(tag.Get("json"), ",")[0]
+	if prop == "-" {
+		return "", false
+	}
+	if prop == "" {
+		prop = name
+	}
+	if strings.Split(tag.Get("patch"), ",")[0] == "-" {
+		return "", false
+	}
+	return prop, true
+}
+
+// writeDecoder writes a DecodeFunc of the type name and its registration.
+func writeDecoder(w *bytes.Buffer, name string, fields []field) {
+	fn := "patchDecode" + strings.ToUpper(name[:1]) + name[1:]
+	fmt.Fprintf(w, "func init() {\n\tpatch.Register(%s{}, %s)\n}\n\n", name, fn)
+	fmt.Fprintf(w, "// %s decodes a JSON property of %s without reflection.\n", fn, name)
+	fmt.Fprintf(w, "func %s(prop string, decode func(interface{}) error) (interface{}, error) {\n", fn)
+	fmt.Fprintf(w, "\tswitch prop {\n")
+	for _, f := range fields {
+		fmt.Fprintf(w, "\tcase %q:\n\t\tvar v %s\n\t\terr := decode(&v)\n\t\treturn v, err\n", f.prop, f.typ)
+	}
+	fmt.Fprintf(w, "\t}\n")
+	fmt.Fprintf(w, "\treturn nil, errors.New(\"patch: unknown property \" + strconv.Quote(prop))\n")
+	fmt.Fprintf(w, "}\n\n")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate([]string{"testdata/article.go"}, []string{"Article"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	expected := []string{
+		"package testdata",
+		`tm "time"`,
+		`"net/url"`,
+		"patch.Register(Article{}, patchDecodeArticle)",
+		"case \"Base\":\n\t\tvar v *Base\n",
+		"case \"Title\":\n\t\tvar v string\n",
+		"case \"Desc\":\n\t\tvar v string\n",
+		"case \"body\":\n\t\tvar v string\n",
+		"case \"published\":\n\t\tvar v *tm.Time\n",
+		"case \"link\":\n\t\tvar v url.URL\n",
+		"case \"extra\":\n\t\tvar v struct{ A int }\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(s, e) {
+			t.Fatalf("should contain %q:\n%s", e, s)
+		}
+	}
+	for _, prop := range []string{"Secret", "Ignored", "private"} {
+		if strings.Contains(s, `case "`+prop+`"`) {
+			t.Fatalf("should not contain %s:\n%s", prop, s)
+		}
+	}
+
+	if _, err := generate([]string{"testdata/article.go"}, []string{"Unknown"}); err == nil {
+		t.Fatal("should fail with unknown type")
+	}
+}
@@ -0,0 +1,22 @@
+package testdata
+
+import (
+	"net/url"
+	tm "time"
+)
+
+type Base struct {
+	ID int `json:"id"`
+}
+
+type Article struct {
+	*Base
+	Title, Desc string
+	Body        string   `json:"body,omitempty" patch:"content"`
+	Published   *tm.Time `json:"published"`
+	Link        url.URL  `json:"link"`
+	Secret      string   `patch:"-"`
+	Ignored     string   `json:"-"`
+	private     int
+	Extra       struct{ A int } `json:"extra"`
+}
@@ -0,0 +1,128 @@
+package patch
+
+import (
+	"strings"
+)
+
+// Violation describes a violated cross-field constraint.
+type Violation struct {
+	// name of the constraint: "together", "exclusive" or "requires"
+	Rule string
+	// keys involved in the violation
+	Keys []string
+	// human readable description
+	message string
+}
+
+// ConstraintError describes violations of cross-field constraints.
+type ConstraintError struct {
+	Violations []Violation
+}
+
+// Error implements error interface.
+func (e *ConstraintError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.message
+	}
+	return "patch: " + strings.Join(messages, "; ")
+}
+
+// constraint is a cross-field constraint evaluated over Fields.
+type constraint struct {
+	// keys the constraint refers to
+	keys []string
+	// check returns a violation or nil
+	check func(f Fields) *Violation
+}
+
+// present returns the keys that f has and doesn't have.
+func present(f Fields, keys []string) (found, missing []string) {
+	for _, key := range keys {
+		if f.getIndex(key) != -1 {
+			found = append(found, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing
+}
+
+// RequireTogether requires that all or none of the given keys are present,
+// like start_date and end_date.
+func RequireTogether(keys ...string) Option {
+	return addConstraint(keys, func(f Fields) *Violation {
+		found, missing := present(f, keys)
+		if len(found) == 0 || len(missing) == 0 {
+			return nil
+		}
+		return &Violation{"together", keys, "keys " + strings.Join(keys, ", ") + " must be given together"}
+	})
+}
+
+// MutuallyExclusive requires that at most one of the given keys is present,
+// like price and price_id.
+func MutuallyExclusive(keys ...string) Option {
+	return addConstraint(keys, func(f Fields) *Violation {
+		found, _ := present(f, keys)
+		if len(found) < 2 {
+			return nil
+		}
+		return &Violation{"exclusive", found, "keys " + strings.Join(found, ", ") + " are mutually exclusive"}
+	})
+}
+
+// RequireWith requires the keys required when key is present, like currency
+// for amount.
+func RequireWith(key string, required ...string) Option {
+	keys := append([]string{key}, required...)
+	return addConstraint(keys, func(f Fields) *Violation {
+		if f.getIndex(key) == -1 {
+			return nil
+		}
+		_, missing := present(f, required)
+		if len(missing) == 0 {
+			return nil
+		}
+		return &Violation{"requires", append([]string{key}, missing...), "key " + key + " requires " + strings.Join(missing, ", ")}
+	})
+}
+
+// addConstraint returns an Option that adds the constraint to Patcher.
+func addConstraint(keys []string, check func(f Fields) *Violation) Option {
+	return func(p *Patcher) {
+		p.constraints = append(p.constraints, constraint{keys, check})
+	}
+}
+
+// checkConstraints evaluates all the constraints over f.
+func (p *Patcher) checkConstraints(f Fields) error {
+	var violations []Violation
+	for _, c := range p.constraints {
+		if v := c.check(f); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+	if len(violations) != 0 {
+		return &ConstraintError{violations}
+	}
+	return nil
+}
+
+// optionProblems returns problems of keys that constraints and transforms
+// refer to.
+func (p *Patcher) optionProblems() (problems []string) {
+	var keys []string
+	for _, c := range p.constraints {
+		keys = append(keys, c.keys...)
+	}
+	for key := range p.transforms {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if _, ok := p.fieldByName(key); !ok {
+			problems = append(problems, "option refers to unknown key '"+key+"'")
+		}
+	}
+	return problems
+}
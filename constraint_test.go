@@ -0,0 +1,51 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	type order struct {
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+		Price     int    `json:"price"`
+		PriceID   string `json:"price_id"`
+		Amount    int    `json:"amount"`
+		Currency  string `json:"currency"`
+	}
+	p := New(order{},
+		RequireTogether("start_date", "end_date"),
+		MutuallyExclusive("price", "price_id"),
+		RequireWith("amount", "currency"),
+	)
+
+	for _, body := range []string{
+		`{"start_date": "a", "end_date": "b"}`,
+		`{"price": 1}`,
+		`{"amount": 1, "currency": "JPY"}`,
+		`{"currency": "JPY"}`,
+	} {
+		if _, err := p.Unmarshal([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := p.Unmarshal([]byte(`{"end_date": "b", "price": 1, "price_id": "p", "amount": 1}`))
+	cErr, ok := err.(*ConstraintError)
+	if !ok {
+		t.Fatal("want *ConstraintError: ", err)
+	}
+	expected := []Violation{
+		{"together", []string{"start_date", "end_date"}, "keys start_date, end_date must be given together"},
+		{"exclusive", []string{"price", "price_id"}, "keys price, price_id are mutually exclusive"},
+		{"requires", []string{"amount", "currency"}, "key amount requires currency"},
+	}
+	if !reflect.DeepEqual(cErr.Violations, expected) {
+		t.Fatalf("want %v, got %v", expected, cErr.Violations)
+	}
+
+	if _, err := Compile(order{}, RequireWith("amount", "cur")); err == nil {
+		t.Fatal("should fail with unknown key")
+	}
+}
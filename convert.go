@@ -0,0 +1,90 @@
+package patch
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// Converter converts a field value to a value that database drivers accept.
+type Converter func(v interface{}) (driver.Value, error)
+
+var (
+	convertersMu sync.RWMutex
+	converters   = make(map[reflect.Type]Converter)
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// RegisterConverter registers fn as the converter for values of the same type
+// as src. A registered converter takes precedence over driver.Valuer and the
+// default conversion.
+func RegisterConverter(src interface{}, fn Converter) {
+	convertersMu.Lock()
+	converters[reflect.TypeOf(src)] = fn
+	convertersMu.Unlock()
+}
+
+// lookupConverter returns a registered converter for the given type.
+func lookupConverter(typ reflect.Type) (Converter, bool) {
+	convertersMu.RLock()
+	fn, ok := converters[typ]
+	convertersMu.RUnlock()
+	return fn, ok
+}
+
+// ConvertError describes an error for converting a field value to a driver
+// value.
+type ConvertError struct {
+	// Key of the field that produced the error
+	Key string
+	// original error
+	err error
+}
+
+// Error implements error interface.
+func (e *ConvertError) Error() string {
+	return "patch: cannot convert value on key '" + e.Key + "', " + e.err.Error()
+}
+
+// convertValue converts v to a driver.Value. Registered converters and
+// driver.Valuer are tried first. Structs, maps, slices and arrays are encoded
+// as JSON so that they can be stored in JSON columns.
+func convertValue(v interface{}) (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if fn, ok := lookupConverter(reflect.TypeOf(v)); ok {
+		return fn(v)
+	}
+	rv := reflect.ValueOf(v)
+	if valuer, ok := v.(driver.Valuer); ok {
+		// database/sql does the same for nil pointers of Valuer types.
+		if rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+			return nil, nil
+		}
+		return valuer.Value()
+	}
+	if driver.IsValue(v) {
+		return v, nil
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return convertValue(rv.Elem().Interface())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+		fallthrough
+	case reflect.Struct, reflect.Map, reflect.Array:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
@@ -0,0 +1,131 @@
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+)
+
+// CQL provides a way to build CQL UPDATE statement for Cassandra and
+// ScyllaDB.
+type CQL struct {
+	Fields
+	ttl        interface{}
+	conditions Fields
+}
+
+// CQL returns a CQL with the given Fields.
+func (f Fields) CQL() *CQL {
+	return &CQL{Fields: f}
+}
+
+// CQL returns a CQL with the given Fields that updates collection columns in
+// place by the field types of the struct. A slice of a slice field is
+// appended as key=key+? and entries of a map of a map field are set as
+// key[?]=?, as Push and Merge are. Null, byte slices and other values replace
+// the column.
+func (p *Patcher) CQL(f Fields) *CQL {
+	fields := make(Fields, len(f))
+	for i, data := range f {
+		fields[i] = data
+		sf := p.fieldByIndex(data.index)
+		if sf == nil || isNull(data.Value) || reflect.TypeOf(data.Value) != sf.typ {
+			continue
+		}
+		switch sf.typ.Kind() {
+		case reflect.Slice:
+			if sf.typ.Elem().Kind() != reflect.Uint8 {
+				fields[i].Value = Expr{opPush, data.Value}
+			}
+		case reflect.Map:
+			fields[i].Value = Expr{opMerge, data.Value}
+		}
+	}
+	return fields.CQL()
+}
+
+// TTL sets time to live of the written values in seconds.
+func (c *CQL) TTL(seconds int) {
+	c.ttl = seconds
+}
+
+// If adds a condition of lightweight transaction that the column of the given
+// key equals value, like a version number.
+func (c *CQL) If(key string, value interface{}) {
+	c.conditions = append(c.conditions, Field{key, value, -1})
+}
+
+// Update returns UPDATE statement of table and its arguments, like
+// "UPDATE t USING TTL ? SET a=?,b=? WHERE pk=? IF version=?". The where
+// clause and args are given as is. Default is written as null, Inc and Push
+// are written as key=key+?, Pull as key=key-? and each entry of Merge as
+// key[?]=?. Only these expressions update collections in place; other
+// values replace the whole column unless the CQL is made by Patcher.CQL. It
+// fails when no column is set, e.g. by only an empty Merge.
+func (c *CQL) Update(table, where string, args ...interface{}) (stmt string, values []interface{}, err error) {
+	var buf bytes.Buffer
+	buf.WriteString("UPDATE ")
+	buf.WriteString(table)
+	if c.ttl != nil {
+		buf.WriteString(" USING TTL ?")
+		values = append(values, c.ttl)
+	}
+	buf.WriteString(" SET ")
+	n := 0
+	// assign writes the separator and the key of the n-th assignment.
+	assign := func(key string) {
+		if n != 0 {
+			buf.WriteString(",")
+		}
+		n++
+		buf.WriteString(key)
+	}
+	for _, f := range c.Fields {
+		switch v := f.Value.(type) {
+		case keyword:
+			// Default is the only keyword, which CQL doesn't have
+			assign(f.Key)
+			buf.WriteString("=null")
+			continue
+		case Expr:
+			if v.op == opMerge {
+				for _, e := range sortedEntries(v.value) {
+					assign(f.Key)
+					buf.WriteString("[?]=?")
+					values = append(values, e.key, e.value)
+				}
+				continue
+			}
+			assign(f.Key)
+			buf.WriteString("=")
+			buf.WriteString(f.Key)
+			if v.op == opPull {
+				buf.WriteString("-?")
+			} else {
+				buf.WriteString("+?")
+			}
+			values = append(values, v.value)
+			continue
+		}
+		assign(f.Key)
+		buf.WriteString("=?")
+		values = append(values, f.Value)
+	}
+	if n == 0 {
+		return "", nil, errors.New("patch: no column to update")
+	}
+	buf.WriteString(" WHERE ")
+	buf.WriteString(where)
+	values = append(values, args...)
+	for i, f := range c.conditions {
+		if i == 0 {
+			buf.WriteString(" IF ")
+		} else {
+			buf.WriteString(" AND ")
+		}
+		buf.WriteString(f.Key)
+		buf.WriteString("=?")
+		values = append(values, f.Value)
+	}
+	return buf.String(), values, nil
+}
@@ -0,0 +1,95 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCQL(t *testing.T) {
+	f := Fields{
+		{"name", "gopher", 1},
+		{"nickname", (*string)(nil), 2},
+		{"theme", Default, 3},
+		{"visits", Inc(1), 4},
+		{"tags", Push("go"), 5},
+		{"roles", Pull("admin"), 6},
+		{"prefs", Merge(map[string]string{"lang": "ja", "color": "red"}), 7},
+	}
+	c := f.CQL()
+	c.TTL(3600)
+	c.If("version", 3)
+	c.If("active", true)
+	stmt, args, err := c.Update("users", "id=?", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "UPDATE users USING TTL ? SET name=?,nickname=?,theme=null,visits=visits+?," +
+		"tags=tags+?,roles=roles-?,prefs[?]=?,prefs[?]=? WHERE id=? IF version=? AND active=?"
+	if stmt != expected {
+		t.Fatalf("want %s, got %s", expected, stmt)
+	}
+	values := []interface{}{
+		3600, "gopher", (*string)(nil), 1, []interface{}{"go"}, []interface{}{"admin"},
+		"color", "red", "lang", "ja", 10, 3, true,
+	}
+	if !reflect.DeepEqual(args, values) {
+		t.Fatalf("want %#v, got %#v", values, args)
+	}
+
+	stmt, args, err = Fields{{"name", "gopher", 1}}.CQL().Update("users", "id=?", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt != "UPDATE users SET name=? WHERE id=?" {
+		t.Fatal("Unexpected statement: ", stmt)
+	}
+	if values := []interface{}{"gopher", 10}; !reflect.DeepEqual(args, values) {
+		t.Fatalf("want %#v, got %#v", values, args)
+	}
+
+	empty := Merge(map[string]string{})
+	stmt, _, err = Fields{{"a", 1, 0}, {"prefs", empty, 1}, {"b", 2, 2}}.CQL().Update("t", "id=?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt != "UPDATE t SET a=?,b=? WHERE id=?" {
+		t.Fatal("Unexpected statement: ", stmt)
+	}
+	if _, _, err = (Fields{{"prefs", empty, 1}}).CQL().Update("t", "id=?", 1); err == nil {
+		t.Fatal("should fail without columns")
+	}
+
+	type user struct {
+		Name  string            `json:"name"`
+		Tags  []string          `json:"tags"`
+		Prefs map[string]string `json:"prefs"`
+		Roles []string          `json:"roles"`
+		Raw   []byte            `json:"raw"`
+	}
+	p := New(user{})
+	f, err = p.Unmarshal([]byte(`{"name": "gopher", "tags": ["a", "b"], "prefs": {"lang": "ja"}, "roles": null, "raw": "AQI="}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, args, err = p.CQL(f).Update("users", "id=?", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt != "UPDATE users SET name=?,tags=tags+?,prefs[?]=?,roles=?,raw=? WHERE id=?" {
+		t.Fatal("Unexpected statement: ", stmt)
+	}
+	values = []interface{}{"gopher", []string{"a", "b"}, "lang", "ja", []string(nil), []byte{1, 2}, 10}
+	if !reflect.DeepEqual(args, values) {
+		t.Fatalf("want %#v, got %#v", values, args)
+	}
+	if v, _ := f.Get("tags"); !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Fatal("Fields should be left untouched: ", v)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Merge should panic with a non-map")
+		}
+	}()
+	Merge([]string{"a"})
+}
@@ -0,0 +1,407 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// valueDecoder reads properties of an input object one by one.
+type valueDecoder interface {
+	// next returns the name of the next property. It returns io.EOF after
+	// the last property.
+	next() (string, error)
+	// decode decodes the value of the current property into v.
+	decode(v interface{}) error
+	// offset returns the input byte offset of the current position.
+	offset() int64
+}
+
+// Decoder reads properties of an input object in a format other than JSON.
+// It lets Parse apply the same key matching, allow-lists, limits on keys and
+// constraints as Unmarshal. Limits on bytes, string lengths and nesting depth
+// are up to the Decoder, which can get them by Patcher.Limits and report them
+// by returning errors such as ErrTooDeep. Other errors of Next and errors
+// wrapping ErrInvalidFormat are reported as malformed input.
+type Decoder interface {
+	// Next returns the name of the next property. It returns io.EOF after
+	// the last property.
+	Next() (string, error)
+	// Decode decodes the value of the current property into v, a pointer to
+	// the type of the struct field or *json.RawMessage for an unknown
+	// property.
+	Decode(v interface{}) error
+}
+
+// ErrInvalidFormat describes malformed input that a Decoder fails to read.
+// A Decoder reports malformed input with an error that wraps it.
+var ErrInvalidFormat = errors.New("invalid input format")
+
+// externalDecoder is a valueDecoder that wraps a Decoder. The input offset is
+// reported if the Decoder has the InputOffset method.
+type externalDecoder struct {
+	Decoder
+}
+
+func (d externalDecoder) next() (string, error) {
+	prop, err := d.Next()
+	if err == nil || err == io.EOF {
+		return prop, err
+	}
+	if _, ok := err.(*ParseError); ok {
+		return "", err
+	}
+	if iErr := d.inputError(err); iErr != nil {
+		return "", iErr
+	}
+	return "", &ParseError{err: ErrInvalidFormat, detail: err.Error(), Offset: d.offset()}
+}
+
+func (d externalDecoder) decode(v interface{}) error {
+	err := d.Decode(v)
+	if iErr := d.inputError(err); iErr != nil {
+		return iErr
+	}
+	return err
+}
+
+// inputError returns a *ParseError if err wraps ErrInvalidFormat or one of
+// the limit errors such as ErrTooDeep, or nil otherwise.
+func (d externalDecoder) inputError(err error) error {
+	for _, reason := range []error{ErrInvalidFormat, ErrTooLarge, ErrStringTooLong, ErrTooDeep} {
+		if errors.Is(err, reason) {
+			pErr := &ParseError{err: reason, Offset: d.offset()}
+			if err != reason {
+				pErr.detail = err.Error()
+			}
+			return pErr
+		}
+	}
+	return nil
+}
+
+func (d externalDecoder) offset() int64 {
+	if o, ok := d.Decoder.(interface{ InputOffset() int64 }); ok {
+		return o.InputOffset()
+	}
+	return 0
+}
+
+// jsonDecoder is a valueDecoder that reads a JSON object from a stream in a
+// single pass.
+type jsonDecoder struct {
+	dec *json.Decoder
+	// whether it has read the opening brace
+	started bool
+	limits
+}
+
+// newJSONDecoder returns a jsonDecoder reading r. Data after the object is
+// left unread.
+func newJSONDecoder(r io.Reader, l limits) *jsonDecoder {
+	if l.maxBytes > 0 {
+		r = &limitReader{r, l.maxBytes}
+	}
+	return &jsonDecoder{dec: json.NewDecoder(r), limits: l}
+}
+
+// syntaxError returns a *ParseError for malformed input.
+func (d *jsonDecoder) syntaxError(err error) error {
+	if err == ErrTooLarge {
+		return &ParseError{err: ErrTooLarge, Offset: d.offset()}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	offset := d.offset()
+	if sErr, ok := err.(*json.SyntaxError); ok {
+		offset = sErr.Offset
+	}
+	return &ParseError{err: errInvalidJSONFormat, detail: err.Error(), Offset: offset}
+}
+
+func (d *jsonDecoder) next() (string, error) {
+	if !d.started {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return "", d.syntaxError(err)
+		}
+		// null is regarded as an empty object like json.Unmarshal does.
+		if tok == nil {
+			return "", io.EOF
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+			return "", &ParseError{err: errInvalidJSONFormat, detail: "input is not a JSON object", Offset: d.offset()}
+		}
+		d.started = true
+	}
+	tok, err := d.dec.Token()
+	if err != nil {
+		return "", d.syntaxError(err)
+	}
+	if key, ok := tok.(string); ok {
+		return key, nil
+	}
+	return "", io.EOF
+}
+
+func (d *jsonDecoder) decode(v interface{}) error {
+	if !d.scanValue() {
+		return d.decodeValue(v)
+	}
+	var raw json.RawMessage
+	if err := d.decodeValue(&raw); err != nil {
+		return err
+	}
+	if err := d.checkValue(raw); err != nil {
+		return &ParseError{err: err, Offset: d.offset()}
+	}
+	if dst, ok := v.(*json.RawMessage); ok {
+		*dst = raw
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// decodeValue decodes the next value into v.
+func (d *jsonDecoder) decodeValue(v interface{}) error {
+	err := d.dec.Decode(v)
+	switch err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		return d.syntaxError(err)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == ErrTooLarge {
+		return d.syntaxError(err)
+	}
+	return err
+}
+
+func (d *jsonDecoder) offset() int64 {
+	return d.dec.InputOffset()
+}
+
+// bytesDecoder is a valueDecoder that reads a JSON object in memory. It finds
+// the end of each value by itself and unmarshals the value with
+// json.Unmarshal, which avoids buffering and tokens of json.Decoder.
+type bytesDecoder struct {
+	buf []byte
+	// input byte offset
+	off int
+	// whether it has read the opening brace
+	started bool
+	// fields keyed by property names to avoid allocating names
+	props map[string]*structField
+	limits
+}
+
+// syntaxError returns a *ParseError for malformed input at the offset off.
+func (d *bytesDecoder) syntaxError(detail string, off int) error {
+	return &ParseError{err: errInvalidJSONFormat, detail: detail, Offset: int64(off)}
+}
+
+// unexpected returns a *ParseError for the current byte or the end of input.
+func (d *bytesDecoder) unexpected(context string) error {
+	if d.off >= len(d.buf) {
+		return d.syntaxError("unexpected end of JSON input", len(d.buf))
+	}
+	return d.syntaxError("invalid character "+strconv.QuoteRune(rune(d.buf[d.off]))+" "+context, d.off+1)
+}
+
+// skipSpace skips white spaces and returns the next byte, or 0 at the end.
+func (d *bytesDecoder) skipSpace() byte {
+	for ; d.off < len(d.buf); d.off++ {
+		switch c := d.buf[d.off]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c
+		}
+	}
+	return 0
+}
+
+func (d *bytesDecoder) next() (string, error) {
+	if !d.started {
+		switch d.skipSpace() {
+		case '{':
+			d.started = true
+			d.off++
+			if d.skipSpace() == '}' {
+				d.off++
+				return "", d.end()
+			}
+		case 'n':
+			// null is regarded as an empty object like json.Unmarshal does.
+			if err := d.skipLiteral("null"); err != nil {
+				return "", err
+			}
+			return "", d.end()
+		case 0:
+			return "", d.unexpected("")
+		default:
+			return "", d.syntaxError("input is not a JSON object", d.off+1)
+		}
+	} else {
+		switch d.skipSpace() {
+		case ',':
+			d.off++
+			d.skipSpace()
+		case '}':
+			d.off++
+			return "", d.end()
+		default:
+			return "", d.unexpected("after object key:value pair")
+		}
+	}
+	if d.off >= len(d.buf) || d.buf[d.off] != '"' {
+		return "", d.unexpected("looking for beginning of object key string")
+	}
+	start := d.off
+	plain, err := d.skipString()
+	if err != nil {
+		return "", err
+	}
+	key := d.buf[start+1 : d.off-1]
+	if !plain {
+		var s string
+		if err := json.Unmarshal(d.buf[start:d.off], &s); err != nil {
+			return "", d.syntaxError(err.Error(), d.off)
+		}
+		return s, nil
+	}
+	if f, ok := d.props[string(key)]; ok {
+		return f.prop, nil
+	}
+	return string(key), nil
+}
+
+// end checks the rest of the input and returns io.EOF when it's fine.
+func (d *bytesDecoder) end() error {
+	if d.skipSpace() != 0 {
+		return d.syntaxError("invalid data after top-level value", d.off+1)
+	}
+	return io.EOF
+}
+
+func (d *bytesDecoder) decode(v interface{}) error {
+	if d.skipSpace() != ':' {
+		return d.unexpected("after object key")
+	}
+	d.off++
+	d.skipSpace()
+	start := d.off
+	if err := d.skipValue(); err != nil {
+		return err
+	}
+	raw := d.buf[start:d.off]
+	if d.scanValue() {
+		if err := d.checkValue(raw); err != nil {
+			return &ParseError{err: err, Offset: d.offset()}
+		}
+	}
+	// json.Unmarshal validates raw even for *json.RawMessage of unknown
+	// properties, which skipValue doesn't.
+	err := json.Unmarshal(raw, v)
+	if sErr, ok := err.(*json.SyntaxError); ok {
+		return d.syntaxError(sErr.Error(), start+int(sErr.Offset))
+	}
+	return err
+}
+
+// skipString skips a string at the current offset and reports whether it has
+// neither escapes nor non-ASCII characters.
+func (d *bytesDecoder) skipString() (plain bool, err error) {
+	plain = true
+	for i := d.off + 1; i < len(d.buf); i++ {
+		switch c := d.buf[i]; {
+		case c == '"':
+			d.off = i + 1
+			return plain, nil
+		case c == '\\':
+			plain = false
+			i++
+		case c < 0x20:
+			d.off = i
+			return false, d.unexpected("in string literal")
+		case c >= 0x80:
+			plain = false
+		}
+	}
+	d.off = len(d.buf)
+	return false, d.unexpected("")
+}
+
+// skipLiteral skips the literal s such as true.
+func (d *bytesDecoder) skipLiteral(s string) error {
+	for i := 0; i < len(s); i++ {
+		if d.off >= len(d.buf) || d.buf[d.off] != s[i] {
+			return d.unexpected("in literal " + s)
+		}
+		d.off++
+	}
+	return nil
+}
+
+// skipValue skips a value at the current offset. Strings, numbers and the
+// inside of objects and arrays are validated by json.Unmarshal later.
+func (d *bytesDecoder) skipValue() error {
+	if d.off >= len(d.buf) {
+		return d.unexpected("")
+	}
+	switch d.buf[d.off] {
+	case '"':
+		_, err := d.skipString()
+		return err
+	case '{', '[':
+		depth := 0
+		for d.off < len(d.buf) {
+			switch d.buf[d.off] {
+			case '"':
+				if _, err := d.skipString(); err != nil {
+					return err
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					d.off++
+					return nil
+				}
+			}
+			d.off++
+		}
+		return d.unexpected("")
+	case 't':
+		return d.skipLiteral("true")
+	case 'f':
+		return d.skipLiteral("false")
+	case 'n':
+		return d.skipLiteral("null")
+	}
+	start := d.off
+	for ; d.off < len(d.buf); d.off++ {
+		c := d.buf[d.off]
+		if !('0' <= c && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E') {
+			break
+		}
+	}
+	if d.off == start {
+		return d.unexpected("looking for beginning of value")
+	}
+	return nil
+}
+
+func (d *bytesDecoder) offset() int64 {
+	return int64(d.off)
+}
+
+// CBORKey returns the property name of the field that declares the integer
+// map key n of CBOR input by the cbor option of patch tag, like
+// `patch:",cbor=3"`.
+func (p *Patcher) CBORKey(n int64) (string, bool) {
+	prop, ok := p.cborKeys[n]
+	return prop, ok
+}
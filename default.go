@@ -0,0 +1,37 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// keyword is a Field value that SQL builders write as a SQL keyword instead
+// of a placeholder. It's unexported so that only Default can be written into
+// SQL as is.
+type keyword string
+
+// Default resets a column to its default value of the database schema.
+// It is the value of a field whose patch tag has the "default" option without
+// a value when the input has null for the field.
+const Default keyword = "DEFAULT"
+
+// parseDefault parses the default option of patch tag for a field of typ.
+// "default=value" declares the Go value, which is parsed as JSON or as a
+// string otherwise, and "default" declares Default. A value containing
+// commas must be in single quotes, like default='["a","b"]'.
+func parseDefault(opt, value string, typ reflect.Type) (interface{}, error) {
+	if !strings.ContainsRune(opt, '=') {
+		return Default, nil
+	}
+	v := reflect.New(typ)
+	if json.Unmarshal([]byte(value), v.Interface()) == nil {
+		return v.Elem().Interface(), nil
+	}
+	if json.Unmarshal([]byte(strconv.Quote(value)), v.Interface()) == nil {
+		return v.Elem().Interface(), nil
+	}
+	return nil, errors.New("invalid default value '" + value + "' for " + typ.String())
+}
@@ -0,0 +1,78 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	type settings struct {
+		Theme    string   `json:"theme" patch:",default=light"`
+		PageSize int      `json:"page_size" patch:",default=20"`
+		Days     []string `json:"days" patch:",default=[\"mon\"]"`
+		Lang     *string  `json:"lang" patch:",default"`
+		Title    *string  `json:"title"`
+		Blank    string   `json:"blank" patch:",trim,default="`
+	}
+	p := New(settings{})
+	f, err := p.Unmarshal([]byte(`{"theme": null, "page_size": null, "days": null, "lang": null, "title": null, "blank": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{"light", 20, []string{"mon"}, Default, (*string)(nil), ""}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+
+	f, err = p.Unmarshal([]byte(`{"theme": "dark", "lang": "ja", "blank": " a "}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lang := "ja"
+	expected = []interface{}{"dark", &lang, "a"}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+
+	type invalid struct {
+		PageSize int `json:"page_size" patch:",default=abc"`
+	}
+	if _, err := Compile(invalid{}); err == nil {
+		t.Fatal("should fail with invalid default value")
+	}
+}
+
+func TestDefaultQuoted(t *testing.T) {
+	type settings struct {
+		Days  []string          `json:"days" patch:",default='[\"mon\",\"tue\"]',trim"`
+		Prefs map[string]string `json:"prefs" patch:"preferences,default='{\"a\":\"b\",\"c\":\"d\"}'"`
+		Quote string            `json:"quote" patch:",default=it's,trim"`
+		Comma string            `json:"comma" patch:",default='a,b'"`
+	}
+	p := New(settings{})
+	f, err := p.Unmarshal([]byte(`{"days": null, "prefs": null, "quote": null, "comma": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		[]string{"mon", "tue"}, map[string]string{"a": "b", "c": "d"}, "it's", "a,b",
+	}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+	if keys := f.Keys(); keys[1] != "preferences" {
+		t.Fatal("Unexpected keys: ", keys)
+	}
+
+	type unquoted struct {
+		Days []string `json:"days" patch:",default=[\"x\",\"y\"]"`
+	}
+	_, err = Compile(unquoted{})
+	sErr, ok := err.(*StructError)
+	if !ok || !reflect.DeepEqual(sErr.Problems, []string{
+		`field Days: invalid default value '["x"' for []string`,
+		`field Days: unsupported patch option '"y"]'`,
+	}) {
+		t.Fatal("Unexpected error: ", err)
+	}
+}
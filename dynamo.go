@@ -0,0 +1,114 @@
+package patch
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Dynamo provides a way to build input of DynamoDB UpdateItem.
+type Dynamo struct {
+	Fields
+	conditions Fields
+	names      map[string]string
+	aliases    map[string]string
+	values     map[string]interface{}
+}
+
+// DynamoUpdate is an update expression with its attribute names and values.
+type DynamoUpdate struct {
+	UpdateExpression          string
+	ConditionExpression       string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]interface{}
+}
+
+// Dynamo returns a Dynamo with the given Fields.
+func (f Fields) Dynamo() *Dynamo {
+	return &Dynamo{Fields: f}
+}
+
+// Condition adds a guard that the attribute of the given key equals value,
+// like a version number for optimistic locking.
+func (d *Dynamo) Condition(key string, value interface{}) {
+	d.conditions = append(d.conditions, Field{key, value, -1})
+}
+
+// name returns an alias of the attribute path key. Each segment of a dotted
+// key is aliased so that reserved words can be used.
+func (d *Dynamo) name(key string) string {
+	segments := strings.Split(key, ".")
+	for i, s := range segments {
+		alias, ok := d.aliases[s]
+		if !ok {
+			alias = "#n" + strconv.Itoa(len(d.names))
+			d.names[alias] = s
+			d.aliases[s] = alias
+		}
+		segments[i] = alias
+	}
+	return strings.Join(segments, ".")
+}
+
+// value returns a placeholder of v.
+func (d *Dynamo) value(v interface{}) string {
+	placeholder := ":v" + strconv.Itoa(len(d.values))
+	d.values[placeholder] = v
+	return placeholder
+}
+
+// Update returns DynamoUpdate of the fields. Null values and Default are
+// removed by REMOVE, Inc is written as ADD and Push appends to a list with
+// list_append. It fails without fields to update.
+func (d *Dynamo) Update() (*DynamoUpdate, error) {
+	d.names = make(map[string]string)
+	d.aliases = make(map[string]string)
+	d.values = make(map[string]interface{})
+	var set, remove, add, conditions []string
+	for _, f := range d.Fields {
+		name := d.name(f.Key)
+		switch v := f.Value.(type) {
+		case keyword:
+			remove = append(remove, name)
+		case Expr:
+			switch v.op {
+			case opInc:
+				add = append(add, name+" "+d.value(v.value))
+			case opPush:
+				empty := d.value([]interface{}{})
+				set = append(set, name+" = list_append(if_not_exists("+name+", "+empty+"), "+d.value(v.value)+")")
+			default:
+				return nil, errors.New("patch: expression is not supported by DynamoDB on key '" + f.Key + "'")
+			}
+		default:
+			if isNull(v) {
+				remove = append(remove, name)
+			} else {
+				set = append(set, name+" = "+d.value(v))
+			}
+		}
+	}
+	for _, f := range d.conditions {
+		conditions = append(conditions, d.name(f.Key)+" = "+d.value(f.Value))
+	}
+
+	var clauses []string
+	if len(set) != 0 {
+		clauses = append(clauses, "SET "+strings.Join(set, ", "))
+	}
+	if len(remove) != 0 {
+		clauses = append(clauses, "REMOVE "+strings.Join(remove, ", "))
+	}
+	if len(add) != 0 {
+		clauses = append(clauses, "ADD "+strings.Join(add, ", "))
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("patch: no attribute to update")
+	}
+	return &DynamoUpdate{
+		UpdateExpression:          strings.Join(clauses, " "),
+		ConditionExpression:       strings.Join(conditions, " AND "),
+		ExpressionAttributeNames:  d.names,
+		ExpressionAttributeValues: d.values,
+	}, nil
+}
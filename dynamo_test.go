@@ -0,0 +1,56 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDynamo(t *testing.T) {
+	f := Fields{
+		{"name", "gopher", 1},
+		{"address.name", "Tokyo", 2},
+		{"nickname", (*string)(nil), 3},
+		{"visits", Inc(1), 4},
+		{"tags", Push("go"), 5},
+		{"theme", Default, 6},
+	}
+	d := f.Dynamo()
+	d.Condition("version", 3)
+	u, err := d.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &DynamoUpdate{
+		UpdateExpression: "SET #n0 = :v0, #n1.#n0 = :v1, #n4 = list_append(if_not_exists(#n4, :v3), :v4) " +
+			"REMOVE #n2, #n5 ADD #n3 :v2",
+		ConditionExpression: "#n6 = :v5",
+		ExpressionAttributeNames: map[string]string{
+			"#n0": "name",
+			"#n1": "address",
+			"#n2": "nickname",
+			"#n3": "visits",
+			"#n4": "tags",
+			"#n5": "theme",
+			"#n6": "version",
+		},
+		ExpressionAttributeValues: map[string]interface{}{
+			":v0": "gopher",
+			":v1": "Tokyo",
+			":v2": 1,
+			":v3": []interface{}{},
+			":v4": []interface{}{"go"},
+			":v5": 3,
+		},
+	}
+	if !reflect.DeepEqual(u, expected) {
+		t.Fatalf("want %#v, got %#v", expected, u)
+	}
+	d = Fields{}.Dynamo()
+	d.Condition("version", 3)
+	if _, err := d.Update(); err == nil {
+		t.Fatal("should fail without fields")
+	}
+	if _, err := (Fields{{"tags", Pull("go"), 1}}).Dynamo().Update(); err == nil {
+		t.Fatal("should fail with Pull")
+	}
+}
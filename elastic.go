@@ -0,0 +1,102 @@
+package patch
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Elastic returns a request body of Elasticsearch/OpenSearch _update API for
+// the fields. It is a partial document {"doc": {...}} whose nested objects
+// are rebuilt from dotted keys, and null values and Default are set to null.
+// When the fields have Inc or Push, a Painless script with params is
+// returned instead so that the expressions are applied to the stored
+// document.
+func (f Fields) Elastic() (map[string]interface{}, error) {
+	for _, data := range f {
+		if _, ok := data.Value.(Expr); ok {
+			return f.elasticScript()
+		}
+	}
+	doc := make(map[string]interface{})
+	for _, data := range f {
+		v := data.Value
+		if _, ok := v.(keyword); ok || isNull(v) {
+			v = nil
+		}
+		if err := setPath(doc, strings.Split(data.Key, "."), v); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"doc": doc}, nil
+}
+
+// setPath sets v to the nested object m at the path.
+func setPath(m map[string]interface{}, path []string, v interface{}) error {
+	for _, key := range path[:len(path)-1] {
+		child, ok := m[key]
+		if !ok {
+			child = make(map[string]interface{})
+			m[key] = child
+		}
+		if m, ok = child.(map[string]interface{}); !ok {
+			return errors.New("patch: conflicting key '" + key + "'")
+		}
+	}
+	key := path[len(path)-1]
+	if _, ok := m[key].(map[string]interface{}); ok {
+		return errors.New("patch: conflicting key '" + key + "'")
+	}
+	m[key] = v
+	return nil
+}
+
+// elasticScript returns a request body with a Painless script that applies
+// the fields. Missing parent objects of nested keys are created as empty
+// maps.
+func (f Fields) elasticScript() (map[string]interface{}, error) {
+	var source []string
+	params := make(map[string]interface{})
+	// parent objects that are created when they are missing
+	guarded := make(map[string]bool)
+	for i, data := range f {
+		field := "ctx._source"
+		for j, key := range strings.Split(data.Key, ".") {
+			if j != 0 && !guarded[field] {
+				guarded[field] = true
+				source = append(source, "if ("+field+" == null) { "+field+" = [:] }")
+			}
+			field += "['" + strings.Replace(key, "'", "\\'", -1) + "']"
+		}
+		param := "params.p" + strconv.Itoa(i)
+		v := data.Value
+		switch e := v.(type) {
+		case keyword:
+			v = nil
+		case Expr:
+			v = e.value
+			switch e.op {
+			case opInc:
+				source = append(source, "if ("+field+" == null) { "+field+" = "+param+" } else { "+field+" += "+param+" }")
+			case opPush:
+				source = append(source, "if ("+field+" == null) { "+field+" = "+param+" } else { "+field+".addAll("+param+") }")
+			default:
+				return nil, errors.New("patch: expression is not supported by Elasticsearch on key '" + data.Key + "'")
+			}
+			params["p"+strconv.Itoa(i)] = v
+			continue
+		}
+		if isNull(v) {
+			v = nil
+		}
+		source = append(source, field+" = "+param)
+		params["p"+strconv.Itoa(i)] = v
+	}
+	return map[string]interface{}{
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": strings.Join(source, "; "),
+			"params": params,
+		},
+	}, nil
+}
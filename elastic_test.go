@@ -0,0 +1,74 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestElastic(t *testing.T) {
+	f := Fields{
+		{"name", "gopher", 1},
+		{"address.city", "Tokyo", 2},
+		{"address.geo.lat", 35.6, 2},
+		{"nickname", (*string)(nil), 3},
+		{"theme", Default, 4},
+	}
+	body, err := f.Elastic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"doc": map[string]interface{}{
+			"name": "gopher",
+			"address": map[string]interface{}{
+				"city": "Tokyo",
+				"geo":  map[string]interface{}{"lat": 35.6},
+			},
+			"nickname": nil,
+			"theme":    nil,
+		},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("want %v, got %v", expected, body)
+	}
+
+	f = Fields{
+		{"address.city", "Tokyo", 1},
+		{"visits", Inc(1), 2},
+		{"tags", Push("go"), 3},
+		{"stats.daily.views", Inc(2), 4},
+		{"address.zip", "100", 1},
+	}
+	body, err = f.Elastic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{
+		"script": map[string]interface{}{
+			"lang": "painless",
+			"source": "if (ctx._source['address'] == null) { ctx._source['address'] = [:] }; " +
+				"ctx._source['address']['city'] = params.p0; " +
+				"if (ctx._source['visits'] == null) { ctx._source['visits'] = params.p1 } else { ctx._source['visits'] += params.p1 }; " +
+				"if (ctx._source['tags'] == null) { ctx._source['tags'] = params.p2 } else { ctx._source['tags'].addAll(params.p2) }; " +
+				"if (ctx._source['stats'] == null) { ctx._source['stats'] = [:] }; " +
+				"if (ctx._source['stats']['daily'] == null) { ctx._source['stats']['daily'] = [:] }; " +
+				"if (ctx._source['stats']['daily']['views'] == null) { ctx._source['stats']['daily']['views'] = params.p3 } " +
+				"else { ctx._source['stats']['daily']['views'] += params.p3 }; " +
+				"ctx._source['address']['zip'] = params.p4",
+			"params": map[string]interface{}{
+				"p0": "Tokyo",
+				"p1": 1,
+				"p2": []interface{}{"go"},
+				"p3": 2,
+				"p4": "100",
+			},
+		},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Fatalf("want %v, got %v", expected, body)
+	}
+
+	if _, err := (Fields{{"a", 1, 1}, {"a.b", 2, 1}}).Elastic(); err == nil {
+		t.Fatal("should fail with conflicting keys")
+	}
+}
@@ -0,0 +1,83 @@
+package patch
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// exprOp is an operator of Expr.
+type exprOp int
+
+const (
+	opInc exprOp = iota + 1
+	opPush
+	opPull
+	opMerge
+)
+
+// Expr is a Field value that updates the current value of the field rather
+// than replacing it. Output backends that don't support an expression report
+// an error.
+type Expr struct {
+	op    exprOp
+	value interface{}
+}
+
+// Inc returns an Expr that increments the current value by n.
+func Inc(n interface{}) Expr {
+	return Expr{opInc, n}
+}
+
+// Push returns an Expr that appends the given values to the current array.
+func Push(values ...interface{}) Expr {
+	return Expr{opPush, values}
+}
+
+// Pull returns an Expr that removes the given values from the current array
+// or set.
+func Pull(values ...interface{}) Expr {
+	return Expr{opPull, values}
+}
+
+// Merge returns an Expr that sets entries of the map m to the current map
+// leaving other entries. It panics when m isn't a map.
+func Merge(m interface{}) Expr {
+	if reflect.ValueOf(m).Kind() != reflect.Map {
+		panic(fmt.Sprintf("patch: Merge of non-map %T", m))
+	}
+	return Expr{opMerge, m}
+}
+
+// mapEntry is a key and value of a map.
+type mapEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// sortedEntries returns entries of the map m in order of formatted keys.
+func sortedEntries(m interface{}) []mapEntry {
+	rv := reflect.ValueOf(m)
+	entries := make([]mapEntry, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		entries = append(entries, mapEntry{k.Interface(), rv.MapIndex(k).Interface()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return fmt.Sprint(entries[i].key) < fmt.Sprint(entries[j].key)
+	})
+	return entries
+}
+
+// isNull reports whether v is nil or a nil pointer, which is an explicit
+// null of JSON input.
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -32,7 +32,7 @@ type Fields []Field
 
 // sort make fields in order of struct field index.
 func (f Fields) sort() {
-	sort.Sort(byFieldIndex(f))
+	sort.Stable(byFieldIndex(f))
 }
 
 // Keys returns a slice of key strings.
@@ -82,6 +82,27 @@ func (f Fields) Get(name string) (interface{}, bool) {
 	return nil, false
 }
 
+// has reports whether f has a field of the given struct field index.
+func (f Fields) has(index int) bool {
+	for _, data := range f {
+		if data.index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// put sets the given field replacing a field of the same struct field.
+func (f Fields) put(field Field) Fields {
+	for i, data := range f {
+		if data.index == field.index {
+			f[i] = field
+			return f
+		}
+	}
+	return append(f, field)
+}
+
 // Set appends the given value with the given name.
 // It overwrite the value if name exists.
 func (f *Fields) Set(name string, value interface{}) {
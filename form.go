@@ -0,0 +1,266 @@
+package patch
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// formDecoder is a valueDecoder that reads form values. Repeated keys are
+// decoded to slices.
+type formDecoder struct {
+	keys   []string
+	values url.Values
+	files  map[string][]*multipart.FileHeader
+	// index of the current key plus one
+	i int
+	limits
+}
+
+// newFormDecoder returns a formDecoder of values and files in order of keys.
+func newFormDecoder(values url.Values, files map[string][]*multipart.FileHeader, l limits) *formDecoder {
+	keys := make([]string, 0, len(values)+len(files))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	for key := range files {
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &formDecoder{keys: keys, values: values, files: files, limits: l}
+}
+
+func (d *formDecoder) next() (string, error) {
+	if d.i == len(d.keys) {
+		return "", io.EOF
+	}
+	d.i++
+	return d.keys[d.i-1], nil
+}
+
+func (d *formDecoder) decode(v interface{}) error {
+	key := d.keys[d.i-1]
+	rv := reflect.ValueOf(v).Elem()
+	if files, ok := d.files[key]; ok {
+		return setFiles(rv, files)
+	}
+	values := d.values[key]
+	for _, s := range values {
+		if d.maxString > 0 && len(s) > d.maxString {
+			return &ParseError{err: ErrStringTooLong}
+		}
+	}
+	return setForm(rv, values)
+}
+
+func (d *formDecoder) offset() int64 {
+	return 0
+}
+
+// setFiles sets uploaded files to rv typed as *multipart.FileHeader or a
+// slice of them.
+func setFiles(rv reflect.Value, files []*multipart.FileHeader) error {
+	switch {
+	case rv.Type() == fileHeaderType:
+		rv.Set(reflect.ValueOf(files[0]))
+	case rv.Type() == reflect.SliceOf(fileHeaderType):
+		rv.Set(reflect.ValueOf(files))
+	case rv.Type() == rawMessageType:
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.Filename
+		}
+		b, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		rv.SetBytes(b)
+	case rv.Kind() == reflect.Ptr:
+		p := reflect.New(rv.Type().Elem())
+		if err := setFiles(p.Elem(), files); err != nil {
+			return err
+		}
+		rv.Set(p)
+	default:
+		return errors.New("cannot set file to " + rv.Type().String())
+	}
+	return nil
+}
+
+// setForm sets form values to rv converting them to the type of rv. An empty
+// value sets nil to a pointer.
+func setForm(rv reflect.Value, values []string) error {
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	if rv.Type() == rawMessageType {
+		var b []byte
+		var err error
+		if len(values) == 1 {
+			b, err = json.Marshal(values[0])
+		} else {
+			b, err = json.Marshal(values)
+		}
+		if err != nil {
+			return err
+		}
+		rv.SetBytes(b)
+		return nil
+	}
+	if reflect.PtrTo(rv.Type()).Implements(textUnmarshalerType) ||
+		reflect.PtrTo(rv.Type()).Implements(unmarshalerType) {
+		return setSingle(rv, values)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if len(values) == 1 && values[0] == "" {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		p := reflect.New(rv.Type().Elem())
+		if err := setForm(p.Elem(), values); err != nil {
+			return err
+		}
+		rv.Set(p)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		s := reflect.MakeSlice(rv.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setForm(s.Index(i), []string{v}); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+		return nil
+	case reflect.Array:
+		if len(values) > rv.Len() {
+			return errors.New("too many values for " + rv.Type().String())
+		}
+		for i, v := range values {
+			if err := setForm(rv.Index(i), []string{v}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setSingle(rv, values)
+}
+
+// setSingle sets the only value of values to rv. Repeated keys of a field
+// that isn't a slice or an array are rejected as duplicates rather than
+// taking one of them.
+func setSingle(rv reflect.Value, values []string) error {
+	if len(values) > 1 {
+		return &ParseError{err: errDuplicateKey}
+	}
+	return setString(rv, values[0])
+}
+
+// setString sets a form value s to rv.
+func setString(rv reflect.Value, s string) error {
+	if u, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if u, ok := rv.Addr().Interface().(json.Unmarshaler); ok {
+		// try a JSON string first, then the raw value like a number
+		if err := u.UnmarshalJSON([]byte(strconv.Quote(s))); err == nil {
+			return nil
+		}
+		return u.UnmarshalJSON([]byte(s))
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Bool:
+		// checkboxes send "on" unless they have a value attribute
+		switch s {
+		case "on":
+			rv.SetBool(true)
+			return nil
+		case "off":
+			rv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(n)
+	case reflect.Slice:
+		// []byte
+		rv.SetBytes([]byte(s))
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return errors.New("cannot set string to " + rv.Type().String())
+		}
+		rv.Set(reflect.ValueOf(s))
+	default:
+		// structs and maps are given as JSON
+		return json.Unmarshal([]byte(s), rv.Addr().Interface())
+	}
+	return nil
+}
+
+// UnmarshalForm converts form values such as
+// application/x-www-form-urlencoded body to Fields. Keys are matched to
+// properties in the same way as JSON, and values are converted to types of
+// fields. Repeated keys are decoded to slices and rejected for other fields,
+// and an empty value is nil for a pointer field. Struct and map fields take a JSON value.
+func (p *Patcher) UnmarshalForm(values url.Values) (Fields, error) {
+	return fieldsOf(p.parseFields(newFormDecoder(values, nil, p.limits)))
+}
+
+// UnmarshalMultipart is like UnmarshalForm but takes multipart/form-data.
+// Uploaded files are set to fields typed as *multipart.FileHeader or
+// []*multipart.FileHeader.
+func (p *Patcher) UnmarshalMultipart(form *multipart.Form) (Fields, error) {
+	return fieldsOf(p.parseFields(newFormDecoder(form.Value, form.File, p.limits)))
+}
+
+// UnmarshalQuery is like UnmarshalForm but takes a URL query string such as
+// "active=false&priority=3". Keys that don't match any struct field are
+// always rejected regardless of the Unknown option.
+func (p *Patcher) UnmarshalQuery(query string) (Fields, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, &ParseError{err: ErrInvalidFormat, detail: err.Error()}
+	}
+	strict := *p
+	strict.unknownPolicy = RejectUnknown
+	return strict.UnmarshalForm(values)
+}
@@ -0,0 +1,176 @@
+package patch
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalForm(t *testing.T) {
+	type user struct {
+		Name     string            `json:"name" patch:",trim"`
+		Age      *int              `json:"age"`
+		Admin    bool              `json:"admin"`
+		Score    float64           `json:"score"`
+		Tags     []string          `json:"tags"`
+		Day      Weekday           `json:"day"`
+		Birthday time.Time         `json:"birthday"`
+		Meta     map[string]string `json:"meta"`
+	}
+	p := New(user{})
+	values := url.Values{
+		"name":     {" gopher "},
+		"age":      {"3"},
+		"admin":    {"true"},
+		"score":    {"1.5"},
+		"tags":     {"a", "b"},
+		"day":      {"monday"},
+		"birthday": {"2009-11-10T23:00:00Z"},
+		"meta":     {`{"k": "v"}`},
+	}
+	f, err := p.UnmarshalForm(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age := 3
+	expected := Fields{
+		{"name", "gopher", 0},
+		{"age", &age, 1},
+		{"admin", true, 2},
+		{"score", 1.5, 3},
+		{"tags", []string{"a", "b"}, 4},
+		{"day", Monday, 5},
+		{"birthday", time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC), 6},
+		{"meta", map[string]string{"k": "v"}, 7},
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatal("Unexpected fields: ", f)
+	}
+
+	f, err = p.UnmarshalForm(url.Values{"age": {""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := f.Get("age"); v != (*int)(nil) {
+		t.Fatal("empty value should be nil: ", v)
+	}
+	for s, b := range map[string]bool{"on": true, "off": false} {
+		f, err = p.UnmarshalForm(url.Values{"admin": {s}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := f.Get("admin"); v != b {
+			t.Fatalf("%s should be %v: %v", s, b, v)
+		}
+	}
+
+	for _, values := range []url.Values{
+		{"age": {"three"}},
+		{"admin": {"yes"}},
+		{"day": {"someday"}},
+		{"meta": {"k=v"}},
+	} {
+		_, err := p.UnmarshalForm(values)
+		if pErr, ok := err.(*ParseError); !ok || pErr.err != errUnmarshalField {
+			t.Fatal("Unexpected error: ", err)
+		}
+	}
+	for _, values := range []url.Values{
+		{"name": {"a", "b"}},
+		{"age": {"1", "2"}},
+		{"day": {"monday", "sunday"}},
+	} {
+		_, err := p.UnmarshalForm(values)
+		if pErr, ok := err.(*ParseError); !ok || pErr.err != errDuplicateKey {
+			t.Fatal("Unexpected error: ", err)
+		}
+	}
+	_, err = p.UnmarshalForm(url.Values{"id": {"1"}})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != errUnexpectedField || pErr.Key != "id" {
+		t.Fatal("Unexpected error: ", err)
+	}
+	_, err = p.UnmarshalForm(url.Values{})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != errNoInput {
+		t.Fatal("Unexpected error: ", err)
+	}
+
+	limited := New(user{}, MaxStringLength(3), Unknown(CollectUnknown))
+	_, err = limited.UnmarshalForm(url.Values{"tags": {"abc", "abcd"}})
+	if !errors.Is(err, ErrStringTooLong) {
+		t.Fatal("Unexpected error: ", err)
+	}
+	res, err := limited.parseFields(newFormDecoder(url.Values{"x": {"a", "b"}}, nil, limited.limits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extra := string(res.Extra["x"]); extra != `["a","b"]` {
+		t.Fatal("Unexpected extra: ", extra)
+	}
+}
+
+func TestUnmarshalMultipart(t *testing.T) {
+	type post struct {
+		Title  string                  `json:"title"`
+		Image  *multipart.FileHeader   `json:"image"`
+		Attach []*multipart.FileHeader `json:"attach"`
+	}
+	p := New(post{})
+	image := &multipart.FileHeader{Filename: "a.png"}
+	attach := []*multipart.FileHeader{{Filename: "b.txt"}, {Filename: "c.txt"}}
+	f, err := p.UnmarshalMultipart(&multipart.Form{
+		Value: map[string][]string{"title": {"hello"}},
+		File:  map[string][]*multipart.FileHeader{"image": {image}, "attach": attach},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Fields{{"title", "hello", 0}, {"image", image, 1}, {"attach", attach, 2}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatal("Unexpected fields: ", f)
+	}
+
+	_, err = p.UnmarshalMultipart(&multipart.Form{
+		File: map[string][]*multipart.FileHeader{"title": {image}},
+	})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != errUnmarshalField {
+		t.Fatal("Unexpected error: ", err)
+	}
+}
+
+func TestUnmarshalQuery(t *testing.T) {
+	type item struct {
+		ID       int  `json:"id"`
+		Active   bool `json:"active"`
+		Priority int  `json:"priority"`
+	}
+	p := New(item{}, Unknown(IgnoreUnknown)).Except("id")
+	f, err := p.UnmarshalQuery("active=false&priority=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, Fields{{"active", false, 1}, {"priority", 3, 2}}) {
+		t.Fatal("Unexpected fields: ", f)
+	}
+
+	cases := []struct {
+		query string
+		err   error
+		key   string
+	}{
+		{"", errNoInput, ""},
+		{"active=0&debug=1", errUnexpectedField, "debug"},
+		{"priority=1&priority=3", errDuplicateKey, "priority"},
+		{"id=1", errUnexpectedField, "id"},
+		{"priority=high", errUnmarshalField, "priority"},
+		{"active=%zz", ErrInvalidFormat, ""},
+	}
+	for _, c := range cases {
+		_, err := p.UnmarshalQuery(c.query)
+		if pErr, ok := err.(*ParseError); !ok || pErr.err != c.err || pErr.Key != c.key {
+			t.Fatalf("Unexpected error for %q: %v", c.query, err)
+		}
+	}
+}
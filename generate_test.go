@@ -0,0 +1,104 @@
+package patch_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smagch/patch"
+)
+
+//go:generate go run ./cmd/patchgen -type genUser -output patchgen_test.go generate_test.go
+
+type genUser struct {
+	ID      int
+	Name    string            `json:"name"`
+	Email   string            `json:"email" patch:"email_address"`
+	Active  bool              `patch:"active"`
+	Created time.Time         `json:"created"`
+	Timeout *time.Duration    `json:"timeout"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Ignored int               `json:"-"`
+	hidden  int
+}
+
+type plainUser struct {
+	ID      int
+	Name    string            `json:"name"`
+	Email   string            `json:"email" patch:"email_address"`
+	Active  bool              `patch:"active"`
+	Created time.Time         `json:"created"`
+	Timeout *time.Duration    `json:"timeout"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Ignored int               `json:"-"`
+	hidden  int
+}
+
+// TestGenerated runs the same inputs with each set of options through the
+// generated DecodeFunc and reflection, which must give the same results.
+func TestGenerated(t *testing.T) {
+	optionSets := [][]patch.Option{
+		nil,
+		{patch.CaseInsensitive()},
+		{patch.DisallowDuplicates(true)},
+		{patch.Unknown(patch.CollectUnknown)},
+		{patch.MaxKeys(2), patch.MaxStringLength(4), patch.MaxDepth(2)},
+		{patch.RequireTogether("name", "email_address")},
+		{patch.Transform("name", func(v interface{}) (interface{}, error) {
+			if v == "" {
+				return nil, errors.New("empty name")
+			}
+			return v, nil
+		})},
+	}
+	testCases := []string{
+		`{"ID": 1}`,
+		`{"email": "@.org", "Active": false, "ID": 100, "name": "name"}`,
+		`{"created": "2015-01-02T03:04:05Z", "timeout": 1000}`,
+		`{"timeout": null, "tags": ["a", "b"], "meta": {"a": "b"}}`,
+		`{"NAME": "a", "Email": "b", "name": "c"}`,
+		`{"name": "a", "name": "b"}`,
+		`{"name": ""}`,
+		`{"tags": [["a"]], "meta": {"a": "bcdef"}}`,
+		`{"x": {"y": [1]}, "ID": 2}`,
+		`{"Ignored": 1}`,
+		`{"hidden": 1}`,
+		`{"ID": "1"}`,
+		`{"ID": 1,}`,
+		`{"created": "yesterday"}`,
+		`{}`,
+		`null`,
+		`[]`,
+	}
+	for _, opts := range optionSets {
+		gen := patch.New(genUser{}, opts...)
+		plain := patch.New(plainUser{}, opts...)
+		for i, tc := range testCases {
+			r1, err1 := gen.UnmarshalResult([]byte(tc))
+			r2, err2 := plain.UnmarshalResult([]byte(tc))
+			if !reflect.DeepEqual(r1, r2) {
+				t.Fatalf("%d: want %#v, got %#v", i, r2, r1)
+			}
+			if !reflect.DeepEqual(err1, err2) {
+				t.Fatalf("%d: want %v, got %v", i, err2, err1)
+			}
+			f1, err1 := gen.Decode(strings.NewReader(tc))
+			f2, err2 := plain.Decode(strings.NewReader(tc))
+			if !reflect.DeepEqual(f1, f2) || !reflect.DeepEqual(err1, err2) {
+				t.Fatalf("%d: want %v %v, got %v %v", i, f2, err2, f1, err1)
+			}
+			if f1 == nil {
+				continue
+			}
+			q1, args1 := f1.SQL().Query(1)
+			q2, args2 := f2.SQL().Query(1)
+			if q1 != q2 || !reflect.DeepEqual(args1, args2) {
+				t.Fatalf("%d: want %s, got %s", i, q2, q1)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package bindec implements the parts shared by decoders of binary formats,
+// which read values to plain Go values and convert them to field types
+// through encoding/json.
+package bindec
+
+import (
+	"encoding/json"
+
+	"github.com/smagch/patch"
+)
+
+// MaxNestingDepth caps nesting even if MaxDepth isn't set, the same as
+// encoding/json does.
+const MaxNestingDepth = 10000
+
+// SyntaxError is an error for malformed input, which patch.Patcher reports as
+// patch.ErrInvalidFormat.
+type SyntaxError string
+
+func (e SyntaxError) Error() string {
+	return string(e)
+}
+
+// Unwrap returns patch.ErrInvalidFormat.
+func (e SyntaxError) Unwrap() error {
+	return patch.ErrInvalidFormat
+}
+
+// Limits checks input against limits of a Patcher.
+type Limits struct {
+	patch.Limits
+}
+
+// Bytes fails when the input of n bytes exceeds MaxBytes.
+func (l Limits) Bytes(n int) error {
+	if l.MaxBytes > 0 && int64(n) > l.MaxBytes {
+		return patch.ErrTooLarge
+	}
+	return nil
+}
+
+// Nest returns the depth of a value nested in a value at depth. It fails
+// beyond MaxDepth or MaxNestingDepth.
+func (l Limits) Nest(depth int) (int, error) {
+	depth++
+	if l.MaxDepth > 0 && depth > l.MaxDepth || depth > MaxNestingDepth {
+		return 0, patch.ErrTooDeep
+	}
+	return depth, nil
+}
+
+// String fails when a string of n bytes at depth exceeds MaxStringLength.
+// Property names, which are read at depth 0, aren't limited as in JSON.
+func (l Limits) String(depth, n int) error {
+	if depth > 0 && l.MaxStringLength > 0 && n > l.MaxStringLength {
+		return patch.ErrStringTooLong
+	}
+	return nil
+}
+
+// Convert converts a plain value to v through encoding/json.
+func Convert(value, v interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if raw, ok := v.(*json.RawMessage); ok {
+		*raw = b
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,47 @@
+package bindec
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smagch/patch"
+)
+
+func TestLimits(t *testing.T) {
+	l := Limits{patch.Limits{MaxBytes: 4, MaxStringLength: 2, MaxDepth: 2}}
+	if l.Bytes(4) != nil || l.Bytes(5) != patch.ErrTooLarge {
+		t.Fatal("Unexpected bytes limit")
+	}
+	if l.String(0, 3) != nil || l.String(1, 2) != nil || l.String(1, 3) != patch.ErrStringTooLong {
+		t.Fatal("Unexpected string limit")
+	}
+	if depth, err := l.Nest(1); depth != 2 || err != nil {
+		t.Fatal("Unexpected depth: ", depth, err)
+	}
+	if _, err := l.Nest(2); err != patch.ErrTooDeep {
+		t.Fatal("Unexpected error: ", err)
+	}
+	if _, err := (Limits{}).Nest(MaxNestingDepth); err != patch.ErrTooDeep {
+		t.Fatal("nesting should be capped without MaxDepth: ", err)
+	}
+	if err := SyntaxError("x"); !errors.Is(err, patch.ErrInvalidFormat) {
+		t.Fatal("should be ErrInvalidFormat: ", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var tm time.Time
+	if err := Convert("2009-11-10T23:00:00Z", &tm); err != nil || !tm.Equal(time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)) {
+		t.Fatal("Unexpected time: ", tm, err)
+	}
+	var raw json.RawMessage
+	if err := Convert(map[string]interface{}{"a": []byte{1}}, &raw); err != nil || string(raw) != `{"a":"AQ=="}` {
+		t.Fatal("Unexpected raw message: ", string(raw), err)
+	}
+	var n int
+	if err := Convert("1", &n); err == nil {
+		t.Fatal("should fail with a string")
+	}
+}
@@ -0,0 +1,89 @@
+package patch
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrTooLarge describes that the input exceeds MaxBytes.
+	ErrTooLarge = errors.New("input is too large")
+	// ErrTooManyKeys describes that the input has more properties than
+	// MaxKeys.
+	ErrTooManyKeys = errors.New("too many keys")
+	// ErrStringTooLong describes that a string in a value exceeds
+	// MaxStringLength.
+	ErrStringTooLong = errors.New("string is too long")
+	// ErrTooDeep describes that the input is nested deeper than MaxDepth.
+	ErrTooDeep = errors.New("input is nested too deep")
+)
+
+// limits holds limits of input. Zero means unlimited.
+type limits struct {
+	maxBytes  int64
+	maxKeys   int
+	maxString int
+	maxDepth  int
+}
+
+// scanValue reports whether any limit is enforced on values.
+func (l *limits) scanValue() bool {
+	return l.maxString > 0 || l.maxDepth > 0
+}
+
+// checkValue checks string lengths and nesting depth of the raw JSON value b
+// that is nested in the top-level object.
+func (l *limits) checkValue(b []byte) error {
+	depth, start := 1, 0
+	inString, escaped := false, false
+	for i, c := range b {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if l.maxString > 0 && i-start-1 > l.maxString {
+					return ErrStringTooLong
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString, start = true, i
+		case '[', '{':
+			depth++
+			if l.maxDepth > 0 && depth > l.maxDepth {
+				return ErrTooDeep
+			}
+		case ']', '}':
+			depth--
+		}
+	}
+	return nil
+}
+
+// limitReader is an io.Reader that fails with ErrTooLarge once more than n
+// bytes are read.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
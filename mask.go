@@ -0,0 +1,119 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// canonicalPaths sorts FieldMask paths and removes duplicates and paths that
+// are covered by their ancestors like protobuf's canonical form.
+func canonicalPaths(paths []string) []string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	kept := make(map[string]bool)
+	canonical := make([]string, 0, len(sorted))
+	for _, path := range sorted {
+		if kept[path] || coveredPath(kept, path) {
+			continue
+		}
+		kept[path] = true
+		canonical = append(canonical, path)
+	}
+	return canonical
+}
+
+// coveredPath reports whether any ancestor of path is in kept.
+func coveredPath(kept map[string]bool, path string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '.' && kept[path[:i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask returns FieldMask paths of the given fields in canonical form. Paths
+// consist of JSON property names, and dotted keys of f are nested paths.
+func (p *Patcher) Mask(f Fields) ([]string, error) {
+	paths := make([]string, len(f))
+	for i, data := range f {
+		name, rest := data.Key, ""
+		if i := strings.IndexRune(name, '.'); i != -1 {
+			name, rest = name[:i], name[i:]
+		}
+		sf, ok := p.fieldByName(name)
+		if !ok {
+			return nil, &ParseError{err: errUnexpectedField, Key: data.Key}
+		}
+		paths[i] = sf.prop + rest
+	}
+	return canonicalPaths(paths), nil
+}
+
+// FromMask returns Fields that have values of src for the given FieldMask
+// paths. The first segment of a path is a JSON property name of the struct,
+// and the rest of segments are JSON property names of nested structs. A key
+// of the nested path is the dotted column name and property names, like
+// "address.city". Nested keys work with Mongo and Elastic that update
+// documents by paths, but SQL can't update a part of a column, so SQL.Convert
+// rejects them and SQL.Query skips them. Pass only top-level paths for SQL,
+// which update whole columns such as JSON columns.
+func (p *Patcher) FromMask(src interface{}, paths []string) (Fields, error) {
+	rv := reflect.Indirect(reflect.ValueOf(src))
+	if !rv.IsValid() || rv.Type() != p.typ {
+		return nil, errors.New("patch: src should be " + p.typ.String())
+	}
+	var data Fields
+	for _, path := range canonicalPaths(paths) {
+		segments := strings.Split(path, ".")
+		f, ok := p.fields[segments[0]]
+		if !ok || !p.visible(f) {
+			return nil, &ParseError{err: errUnexpectedField, Key: path}
+		}
+		v, ok := nestedValue(rv.Field(f.index), segments[1:])
+		if !ok {
+			return nil, &ParseError{err: errUnexpectedField, Key: path}
+		}
+		key := strings.Join(append([]string{f.name}, segments[1:]...), ".")
+		data = append(data, Field{key, v, f.index})
+	}
+	data.sort()
+	return data, nil
+}
+
+// nestedValue returns the value of the nested struct field that segments of
+// JSON property names point to. Nil pointers on the way result in nil.
+func nestedValue(v reflect.Value, segments []string) (interface{}, bool) {
+	isNil := false
+	for _, prop := range segments {
+		typ := v.Type()
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return nil, false
+		}
+		f, ok := cachedStruct(typ).fields[prop]
+		if !ok {
+			return nil, false
+		}
+		if !isNil {
+			for v.Kind() == reflect.Ptr && !v.IsNil() {
+				v = v.Elem()
+			}
+			isNil = v.Kind() == reflect.Ptr
+		}
+		if isNil {
+			// keep walking types to validate the rest of segments
+			v = reflect.Zero(f.typ)
+		} else {
+			v = v.Field(f.index)
+		}
+	}
+	if isNil {
+		return nil, true
+	}
+	return v.Interface(), true
+}
@@ -0,0 +1,111 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	type geo struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+	type address struct {
+		City string `json:"city"`
+		Geo  *geo   `json:"geo"`
+	}
+	type user struct {
+		ID      int      `json:"id"`
+		Name    string   `json:"name" patch:"full_name"`
+		Address address  `json:"address" patch:"addr"`
+		Home    *address `json:"home"`
+	}
+	p := New(user{})
+	u := user{
+		ID:      1,
+		Name:    "gopher",
+		Address: address{"Tokyo", &geo{35.6, 139.7}},
+	}
+
+	f, err := p.FromMask(&u, []string{"address.geo.lat", "name", "home.geo.lng", "address.city", "name", "home.city"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Fields{
+		{"full_name", "gopher", 1},
+		{"addr.city", "Tokyo", 2},
+		{"addr.geo.lat", 35.6, 2},
+		{"home.city", nil, 3},
+		{"home.geo.lng", nil, 3},
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("want %v, got %v", expected, f)
+	}
+
+	paths, err := p.Mask(append(f, Field{"addr", nil, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"address", "home.city", "home.geo.lng", "name"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("want %v, got %v", want, paths)
+	}
+
+	for _, path := range []string{"unknown", "address.zip", "id.value", "home.geo.alt"} {
+		if _, err := p.FromMask(u, []string{path}); err == nil {
+			t.Fatal("should fail with: ", path)
+		}
+	}
+	if _, err := p.Mask(Fields{{"address", 1, 2}}); err == nil {
+		t.Fatal("should fail with property name")
+	}
+	if _, err := p.Only("id").FromMask(u, []string{"name"}); err == nil {
+		t.Fatal("should fail with hidden field")
+	}
+}
+
+func TestMaskSQL(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type user struct {
+		Name    string  `json:"name"`
+		Address address `json:"address" patch:"addr"`
+	}
+	p := New(user{})
+	u := user{"gopher", address{"Tokyo"}}
+
+	f, err := p.FromMask(u, []string{"name", "address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.SQL()
+	if err := s.Convert(); err != nil {
+		t.Fatal(err)
+	}
+	q, args := s.Query(1)
+	if q != "name=?,addr=?" || !reflect.DeepEqual(args, []interface{}{"gopher", `{"city":"Tokyo"}`, 1}) {
+		t.Fatal("Unexpected query: ", q, args)
+	}
+
+	f, err = p.FromMask(u, []string{"address.city"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Mongo(); !reflect.DeepEqual(got, map[string]interface{}{
+		"$set": map[string]interface{}{"addr.city": "Tokyo"},
+	}) {
+		t.Fatal("Unexpected update document: ", got)
+	}
+	s = f.SQL()
+	if err, ok := s.Convert().(*ConvertError); !ok || err.Key != "addr.city" {
+		t.Fatal("should fail with nested path: ", err)
+	}
+	f, err = p.FromMask(u, []string{"name", "address.city"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, args = f.SQL().Query(1)
+	if q != "name=?" || !reflect.DeepEqual(args, []interface{}{"gopher", 1}) {
+		t.Fatal("nested path should be skipped: ", q, args)
+	}
+}
@@ -0,0 +1,48 @@
+package patch
+
+import (
+	"fmt"
+)
+
+// Mongo returns a MongoDB update document of the fields, which can be passed
+// to drivers as bson.M. Values are set by $set, and null values and Default
+// are removed by $unset. Inc and Push are written as $inc and $push. Dotted
+// keys work as paths of nested fields. Pull is written as $pullAll and
+// entries of Merge are set with dotted keys.
+func (f Fields) Mongo() map[string]interface{} {
+	doc := make(map[string]interface{})
+	add := func(op, key string, v interface{}) {
+		m, ok := doc[op].(map[string]interface{})
+		if !ok {
+			m = make(map[string]interface{})
+			doc[op] = m
+		}
+		m[key] = v
+	}
+	for _, data := range f {
+		switch v := data.Value.(type) {
+		case keyword:
+			add("$unset", data.Key, "")
+		case Expr:
+			switch v.op {
+			case opInc:
+				add("$inc", data.Key, v.value)
+			case opPush:
+				add("$push", data.Key, map[string]interface{}{"$each": v.value})
+			case opPull:
+				add("$pullAll", data.Key, v.value)
+			case opMerge:
+				for _, e := range sortedEntries(v.value) {
+					add("$set", data.Key+"."+fmt.Sprint(e.key), e.value)
+				}
+			}
+		default:
+			if isNull(v) {
+				add("$unset", data.Key, "")
+			} else {
+				add("$set", data.Key, v)
+			}
+		}
+	}
+	return doc
+}
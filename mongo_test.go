@@ -0,0 +1,45 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMongo(t *testing.T) {
+	f := Fields{
+		{"name", "gopher", 1},
+		{"address.city", "Tokyo", 2},
+		{"nickname", (*string)(nil), 3},
+		{"theme", Default, 4},
+		{"visits", Inc(1), 5},
+		{"tags", Push("go", "mongo"), 6},
+		{"meta", nil, 7},
+		{"roles", Pull("admin"), 8},
+		{"prefs", Merge(map[string]int{"b": 2, "a": 1}), 9},
+	}
+	expected := map[string]interface{}{
+		"$set": map[string]interface{}{
+			"name":         "gopher",
+			"address.city": "Tokyo",
+			"prefs.a":      1,
+			"prefs.b":      2,
+		},
+		"$unset": map[string]interface{}{
+			"nickname": "",
+			"theme":    "",
+			"meta":     "",
+		},
+		"$inc": map[string]interface{}{
+			"visits": 1,
+		},
+		"$pullAll": map[string]interface{}{
+			"roles": []interface{}{"admin"},
+		},
+		"$push": map[string]interface{}{
+			"tags": map[string]interface{}{"$each": []interface{}{"go", "mongo"}},
+		},
+	}
+	if doc := f.Mongo(); !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("want %v, got %v", expected, doc)
+	}
+}
@@ -0,0 +1,307 @@
+// Package msgpack decodes MessagePack input for github.com/smagch/patch.
+//
+// The top-level value must be a map with string keys. Values are decoded to
+// plain Go values and converted to field types through encoding/json, so
+// field types and their json.Unmarshaler implementations work as they do
+// with JSON input. Binary values are converted to []byte fields and the
+// timestamp extension to time.Time fields.
+//
+// Limits of the Patcher apply to MessagePack input as they do to JSON.
+package msgpack
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/smagch/patch"
+	"github.com/smagch/patch/internal/bindec"
+)
+
+// Decoder is a patch.Decoder that reads a MessagePack map.
+type Decoder struct {
+	buf []byte
+	// input byte offset
+	off int
+	// number of properties left in the map; -1 before reading the map header
+	left   int
+	limits bindec.Limits
+}
+
+// NewDecoder returns a Decoder reading b with the limits l, typically
+// Patcher.Limits.
+func NewDecoder(b []byte, l patch.Limits) *Decoder {
+	return &Decoder{buf: b, left: -1, limits: bindec.Limits{Limits: l}}
+}
+
+// Unmarshal decodes MessagePack input b to Fields with p.
+func Unmarshal(p *patch.Patcher, b []byte) (patch.Fields, error) {
+	return p.Parse(NewDecoder(b, p.Limits()))
+}
+
+// UnmarshalResult is like Unmarshal but returns *patch.Result.
+func UnmarshalResult(p *patch.Patcher, b []byte) (*patch.Result, error) {
+	return p.ParseResult(NewDecoder(b, p.Limits()))
+}
+
+// Next implements patch.Decoder.
+func (d *Decoder) Next() (string, error) {
+	if d.left < 0 {
+		if err := d.limits.Bytes(len(d.buf)); err != nil {
+			return "", err
+		}
+		c, err := d.byte()
+		if err != nil {
+			return "", err
+		}
+		if c == 0xc0 {
+			// nil is regarded as an empty map like null in JSON.
+			d.left = 0
+		} else if d.left, err = d.mapLen(c); err != nil {
+			return "", err
+		}
+	}
+	if d.left == 0 {
+		if d.off != len(d.buf) {
+			return "", bindec.SyntaxError("invalid data after top-level value")
+		}
+		return "", io.EOF
+	}
+	d.left--
+	v, err := d.value(0)
+	if err != nil {
+		return "", err
+	}
+	key, ok := v.(string)
+	if !ok {
+		return "", bindec.SyntaxError("map key is not a string")
+	}
+	return key, nil
+}
+
+// Decode implements patch.Decoder.
+func (d *Decoder) Decode(v interface{}) error {
+	value, err := d.value(1)
+	if err != nil {
+		return err
+	}
+	return bindec.Convert(value, v)
+}
+
+// InputOffset returns the input byte offset of the current position.
+func (d *Decoder) InputOffset() int64 {
+	return int64(d.off)
+}
+
+// read returns the next n bytes.
+func (d *Decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.off < n {
+		return nil, bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+func (d *Decoder) byte() (byte, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// uint reads a big-endian unsigned integer of n bytes.
+func (d *Decoder) uint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// length reads a length of n bytes.
+func (d *Decoder) length(n int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.buf)) {
+		return 0, bindec.SyntaxError(io.ErrUnexpectedEOF.Error())
+	}
+	return int(u), nil
+}
+
+// mapLen returns the number of entries of the map whose format byte is c.
+func (d *Decoder) mapLen(c byte) (int, error) {
+	switch {
+	case c >= 0x80 && c <= 0x8f:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		return d.length(2)
+	case c == 0xdf:
+		return d.length(4)
+	}
+	return 0, bindec.SyntaxError("input is not a MessagePack map")
+}
+
+// value reads the next value nested at depth.
+func (d *Decoder) value(depth int) (interface{}, error) {
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f, c == 0xde, c == 0xdf:
+		n, err := d.mapLen(c)
+		if err != nil {
+			return nil, err
+		}
+		if depth, err = d.limits.Nest(depth); err != nil {
+			return nil, err
+		}
+		return d.mapValue(n, depth)
+	case c >= 0x90 && c <= 0x9f:
+		if depth, err = d.limits.Nest(depth); err != nil {
+			return nil, err
+		}
+		return d.array(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c&0x1f), depth)
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := d.uint(n)
+		// sign-extend n bytes
+		shift := uint(64 - 8*n)
+		return int64(u<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n, depth)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		if depth, err = d.limits.Nest(depth); err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	}
+	return nil, bindec.SyntaxError("invalid format byte 0x" + strconv.FormatUint(uint64(c), 16))
+}
+
+// str reads a string of n bytes at depth.
+func (d *Decoder) str(n, depth int) (string, error) {
+	if err := d.limits.String(depth, n); err != nil {
+		return "", err
+	}
+	b, err := d.read(n)
+	return string(b), err
+}
+
+func (d *Decoder) array(n, depth int) ([]interface{}, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// mapValue reads n entries of a map. Keys must be strings so that the map
+// can be converted through encoding/json.
+func (d *Decoder) mapValue(n, depth int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, bindec.SyntaxError("map key is not a string")
+		}
+		if m[key], err = d.value(depth); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ext reads an extension value of n bytes. Only the timestamp extension is
+// supported.
+func (d *Decoder) ext(n int) (interface{}, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != -1 {
+		return nil, bindec.SyntaxError("unsupported extension type " + strconv.Itoa(int(int8(typ))))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(b)
+		sec := int64(binary.BigEndian.Uint64(b[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, bindec.SyntaxError("invalid timestamp length " + strconv.Itoa(n))
+}
@@ -0,0 +1,147 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smagch/patch"
+)
+
+type user struct {
+	Name    string    `json:"name"`
+	Age     *int      `json:"age"`
+	Score   float64   `json:"score"`
+	Tags    []string  `json:"tags"`
+	Avatar  []byte    `json:"avatar"`
+	Created time.Time `json:"created"`
+	Meta    struct {
+		Admin bool `json:"admin"`
+	} `json:"meta"`
+}
+
+// str returns a fixstr.
+func str(s string) []byte {
+	return append([]byte{0xa0 | byte(len(s))}, s...)
+}
+
+func concat(b ...[]byte) []byte {
+	var buf []byte
+	for _, s := range b {
+		buf = append(buf, s...)
+	}
+	return buf
+}
+
+func TestUnmarshal(t *testing.T) {
+	p := patch.New(user{})
+	src := concat(
+		[]byte{0x87},
+		str("name"), str("gopher"),
+		str("age"), []byte{0xd0, 0xfe},
+		str("score"), []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+		str("tags"), []byte{0x92}, str("a"), str("b"),
+		str("avatar"), []byte{0xc4, 0x02, 0x01, 0x02},
+		str("created"), []byte{0xd6, 0xff, 0x4a, 0xf9, 0xf0, 0x70},
+		str("meta"), []byte{0x81}, str("admin"), []byte{0xc3},
+	)
+	f, err := Unmarshal(p, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age := -2
+	var expected user
+	expected.Meta.Admin = true
+	meta, _ := f.Get("meta")
+	if !reflect.DeepEqual(meta, expected.Meta) {
+		t.Fatal("Unexpected meta: ", meta)
+	}
+	for key, value := range map[string]interface{}{
+		"name":    "gopher",
+		"age":     &age,
+		"score":   1.5,
+		"tags":    []string{"a", "b"},
+		"avatar":  []byte{1, 2},
+		"created": time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC),
+	} {
+		v, ok := f.Get(key)
+		if !ok || !reflect.DeepEqual(v, value) {
+			t.Fatal("Unexpected value on ", key, ": ", v)
+		}
+	}
+
+	f, err = Unmarshal(p, concat([]byte{0x81}, str("age"), []byte{0xc0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := f.Get("age"); v != (*int)(nil) {
+		t.Fatal("nil should be decoded to nil pointer: ", v)
+	}
+}
+
+func TestUnmarshalResult(t *testing.T) {
+	p := patch.New(user{}, patch.Unknown(patch.CollectUnknown))
+	res, err := UnmarshalResult(p, concat([]byte{0x82}, str("name"), str("a"), str("x"), []byte{0x92, 0x01, 0xc2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extra := string(res.Extra["x"]); extra != `[1,false]` {
+		t.Fatal("Unexpected extra: ", extra)
+	}
+	if !reflect.DeepEqual(res.Extra["x"], json.RawMessage(`[1,false]`)) || len(res.Fields) != 1 {
+		t.Fatal("Unexpected result: ", res)
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	p := patch.New(user{})
+	cases := []struct {
+		src    []byte
+		detail string
+	}{
+		{nil, "unexpected EOF"},
+		{[]byte{0x80}, "input is empty"},
+		{[]byte{0x92, 0x01, 0x02}, "input is not a MessagePack map"},
+		{concat([]byte{0x82}, str("name"), str("a")), "unexpected EOF"},
+		{concat([]byte{0x81}, str("name"), str("a"), []byte{0x00}), "invalid data after top-level value"},
+		{[]byte{0x81, 0x01, 0x02}, "map key is not a string"},
+		{concat([]byte{0x81}, str("name"), []byte{0xc1}), "invalid format byte 0xc1"},
+		{concat([]byte{0x81}, str("age"), str("a")), "cannot unmarshal"},
+		{concat([]byte{0x81}, str("id"), []byte{0x01}), "unexpected field"},
+	}
+	for _, c := range cases {
+		_, err := Unmarshal(p, c.src)
+		if _, ok := err.(*patch.ParseError); !ok || !strings.Contains(err.Error(), c.detail) {
+			t.Fatalf("Unexpected error for % x: %v", c.src, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	nested := append(concat([]byte{0x81}, str("tags")), bytes.Repeat([]byte{0x91}, 1<<20)...)
+	cases := []struct {
+		opt patch.Option
+		src []byte
+		err error
+	}{
+		{patch.MaxBytes(4), concat([]byte{0x81}, str("name"), str("a")), patch.ErrTooLarge},
+		{patch.MaxKeys(1), concat([]byte{0x82}, str("name"), str("a"), str("age"), []byte{0x01}), patch.ErrTooManyKeys},
+		{patch.MaxStringLength(3), concat([]byte{0x81}, str("tags"), []byte{0x91}, str("abcd")), patch.ErrStringTooLong},
+		{patch.MaxDepth(2), concat([]byte{0x81}, str("meta"), []byte{0x81}, str("admin"), []byte{0x91, 0xc3}), patch.ErrTooDeep},
+		{patch.MaxDepth(0), nested, patch.ErrTooDeep},
+	}
+	for _, c := range cases {
+		_, err := Unmarshal(patch.New(user{}, c.opt), c.src)
+		if _, ok := err.(*patch.ParseError); !ok || !errors.Is(err, c.err) {
+			t.Fatalf("Unexpected error for % x: %v", c.src[:8], err)
+		}
+	}
+	f, err := Unmarshal(patch.New(user{}, patch.MaxStringLength(3)), concat([]byte{0x81}, str("name"), str("abc")))
+	if err != nil || len(f) != 1 {
+		t.Fatal("Unexpected result: ", f, err)
+	}
+}
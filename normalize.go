@@ -0,0 +1,245 @@
+package patch
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// normalizer transforms a decoded value of a field.
+type normalizer func(v reflect.Value) reflect.Value
+
+// stringNormalizers are normalizers of patch tag options for strings.
+var stringNormalizers = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"slug":  slugify,
+}
+
+// slugify converts s to lower case words joined with hyphens.
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() != 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// isNormalizer reports whether key is an option of patch tag for normalizers.
+func isNormalizer(key string) bool {
+	_, ok := stringNormalizers[key]
+	return ok || key == "round" || key == "clamp"
+}
+
+// newNormalizer returns a normalizer of the option key=value for values of
+// typ.
+func newNormalizer(key, value string, typ reflect.Type) (normalizer, error) {
+	kind := scalarKind(typ)
+	if fn, ok := stringNormalizers[key]; ok {
+		if kind != reflect.String {
+			return nil, errors.New("option '" + key + "' requires string type")
+		}
+		return scalarNormalizer(func(v reflect.Value) reflect.Value {
+			return reflect.ValueOf(fn(v.String())).Convert(v.Type())
+		}), nil
+	}
+	switch key {
+	case "round":
+		if kind != reflect.Float32 && kind != reflect.Float64 {
+			return nil, errors.New("option 'round' requires float type")
+		}
+		places, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New("invalid option 'round=" + value + "'")
+		}
+		scale := math.Pow(10, float64(places))
+		return scalarNormalizer(func(v reflect.Value) reflect.Value {
+			n := reflect.New(v.Type()).Elem()
+			n.SetFloat(math.Round(v.Float()*scale) / scale)
+			return n
+		}), nil
+	case "clamp":
+		min, max, err := parseRange(value)
+		if err != nil {
+			return nil, errors.New("invalid option 'clamp=" + value + "'")
+		}
+		i := strings.IndexRune(value, ':')
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			lo, hi := intBound(value[:i], math.Ceil(min)), intBound(value[i+1:], math.Floor(max))
+			if lo > hi {
+				return nil, errors.New("invalid option 'clamp=" + value + "'")
+			}
+			return scalarNormalizer(func(v reflect.Value) reflect.Value {
+				n := reflect.New(v.Type()).Elem()
+				switch x := v.Int(); {
+				case x < lo:
+					n.SetInt(lo)
+				case x > hi:
+					n.SetInt(hi)
+				default:
+					n.SetInt(x)
+				}
+				return n
+			}), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			lo, hi := uintBound(value[:i], math.Ceil(min)), uintBound(value[i+1:], math.Floor(max))
+			if lo > hi {
+				return nil, errors.New("invalid option 'clamp=" + value + "'")
+			}
+			return scalarNormalizer(func(v reflect.Value) reflect.Value {
+				n := reflect.New(v.Type()).Elem()
+				switch x := v.Uint(); {
+				case x < lo:
+					n.SetUint(lo)
+				case x > hi:
+					n.SetUint(hi)
+				default:
+					n.SetUint(x)
+				}
+				return n
+			}), nil
+		case reflect.Float32, reflect.Float64:
+			return scalarNormalizer(func(v reflect.Value) reflect.Value {
+				n := reflect.New(v.Type()).Elem()
+				n.SetFloat(math.Max(min, math.Min(max, v.Float())))
+				return n
+			}), nil
+		}
+		return nil, errors.New("option 'clamp' requires number type")
+	}
+	return nil, errors.New("unsupported patch option '" + key + "'")
+}
+
+// parseRange parses "min:max" of clamp option.
+func parseRange(s string) (min, max float64, err error) {
+	i := strings.IndexRune(s, ':')
+	if i == -1 {
+		return 0, 0, errors.New("missing ':'")
+	}
+	if min, err = strconv.ParseFloat(s[:i], 64); err != nil {
+		return
+	}
+	if max, err = strconv.ParseFloat(s[i+1:], 64); err != nil {
+		return
+	}
+	if min > max {
+		err = errors.New("min is greater than max")
+	}
+	return
+}
+
+// intBound returns a bound s of clamp option for signed integers. A bound
+// that isn't an integer is rounded to f, which is saturated to int64.
+func intBound(s string, f float64) int64 {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	switch {
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+// uintBound returns a bound s of clamp option for unsigned integers as
+// intBound does.
+func uintBound(s string, f float64) uint64 {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n
+	}
+	switch {
+	case f >= math.MaxUint64:
+		return math.MaxUint64
+	case f <= 0:
+		return 0
+	}
+	return uint64(f)
+}
+
+// scalarKind returns the kind of typ looking through pointers and slices.
+func scalarKind(typ reflect.Type) reflect.Kind {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	return typ.Kind()
+}
+
+// scalarNormalizer returns a normalizer that applies fn to v itself or to
+// values that pointers and slices of v refer to. Pointers and slices are
+// copied rather than modified.
+func scalarNormalizer(fn func(v reflect.Value) reflect.Value) normalizer {
+	var n normalizer
+	n = func(v reflect.Value) reflect.Value {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				return v
+			}
+			p := reflect.New(v.Type().Elem())
+			p.Elem().Set(n(v.Elem()))
+			return p
+		case reflect.Slice:
+			if v.IsNil() {
+				return v
+			}
+			s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				s.Index(i).Set(n(v.Index(i)))
+			}
+			return s
+		case reflect.Array:
+			a := reflect.New(v.Type()).Elem()
+			for i := 0; i < v.Len(); i++ {
+				a.Index(i).Set(n(v.Index(i)))
+			}
+			return a
+		}
+		return fn(v)
+	}
+	return n
+}
+
+// normalize applies normalizers of f to v.
+func (f *structField) normalize(v interface{}) interface{} {
+	if len(f.normalizers) == 0 {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return v
+	}
+	for _, n := range f.normalizers {
+		rv = n(rv)
+	}
+	return rv.Interface()
+}
+
+// Transform registers fn that transforms a decoded value of the field with
+// the given key, which is applied after normalizers of patch tag options.
+// An error returned by fn fails the parsing with a *ParseError. It's useful
+// for normalization that the tag options don't offer, like Unicode
+// normalization with golang.org/x/text/unicode/norm.
+func Transform(key string, fn func(v interface{}) (interface{}, error)) Option {
+	return func(p *Patcher) {
+		if p.transforms == nil {
+			p.transforms = make(map[string][]func(interface{}) (interface{}, error))
+		}
+		p.transforms[key] = append(p.transforms[key], fn)
+	}
+}
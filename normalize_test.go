@@ -0,0 +1,93 @@
+package patch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	type nickname string
+	type user struct {
+		Email   string    `json:"email" patch:",trim,lower"`
+		Nick    *nickname `json:"nick" patch:",trim,upper"`
+		Tags    []string  `json:"tags" patch:",slug"`
+		Score   float64   `json:"score" patch:",round=1"`
+		Age     int       `json:"age" patch:",clamp=0:150"`
+		Ratio   *float32  `json:"ratio" patch:",clamp=0:1"`
+		Comment string    `json:"comment"`
+	}
+	p := New(user{}, Transform("comment", func(v interface{}) (interface{}, error) {
+		s := v.(string)
+		if strings.Contains(s, "spam") {
+			return nil, errors.New("spam is not allowed")
+		}
+		return s + "!", nil
+	}))
+	f, err := p.Unmarshal([]byte(`{
+		"email": "  Gopher@Golang.ORG ",
+		"nick": " gopher ",
+		"tags": ["Hello, World!", " Go  Lang "],
+		"score": 3.14159,
+		"age": 200,
+		"ratio": -0.5,
+		"comment": "hello"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nick := nickname("GOPHER")
+	ratio := float32(0)
+	expected := []interface{}{
+		"gopher@golang.org", &nick, []string{"hello-world", "go-lang"}, 3.1, 150, &ratio, "hello!",
+	}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+
+	pErr := assertParseError(t, p, `{"comment": "spam"}`)
+	if pErr.Key != "comment" || pErr.err != errInvalidValue {
+		t.Fatal("Unexpected error: ", pErr)
+	}
+
+	type counter struct {
+		Big   int64  `json:"big" patch:",clamp=0:1e19"`
+		Small int8   `json:"small" patch:",clamp=-1.5:100"`
+		Max   uint64 `json:"max" patch:",clamp=1:18446744073709551615"`
+		Low   uint   `json:"low" patch:",clamp=-10:10.5"`
+	}
+	f, err = New(counter{}).Unmarshal([]byte(`{"big": 9007199254740993, "small": -100, "max": 18446744073709551615, "low": 11}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []interface{}{int64(9007199254740993), int8(-1), uint64(18446744073709551615), uint(10)}
+	if values := f.Values(); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("want %#v, got %#v", expected, values)
+	}
+
+	type invalid struct {
+		Age   int     `json:"age" patch:",trim"`
+		Name  string  `json:"name" patch:",round=2"`
+		Score float64 `json:"score" patch:",round=x,clamp=2:1"`
+		Count int     `json:"count" patch:",clamp=0.2:0.8"`
+	}
+	_, err = Compile(invalid{}, Transform("unknown", nil))
+	sErr, ok := err.(*StructError)
+	if !ok {
+		t.Fatal("want *StructError: ", err)
+	}
+	problems := []string{
+		"field Age: option 'trim' requires string type",
+		"field Name: option 'round' requires float type",
+		"field Score: invalid option 'round=x'",
+		"field Score: invalid option 'clamp=2:1'",
+		"field Count: invalid option 'clamp=0.2:0.8'",
+	}
+	if !reflect.DeepEqual(sErr.Problems, problems) {
+		t.Fatalf("want %v, got %v", problems, sErr.Problems)
+	}
+	if _, err := Compile(user{}, Transform("unknown", nil)); err == nil {
+		t.Fatal("should fail with unknown key")
+	}
+}
@@ -0,0 +1,104 @@
+package patch
+
+// Option configures a Patcher.
+type Option func(*Patcher)
+
+// DisallowDuplicates makes Patcher reject input that has the same property
+// twice. Properties that differ only in case are regarded as duplicates as
+// well if fold is true.
+func DisallowDuplicates(fold bool) Option {
+	return func(p *Patcher) {
+		p.duplicates = rejectDuplicates
+		if fold {
+			p.duplicates = rejectFoldedDuplicates
+		}
+	}
+}
+
+// CaseInsensitive makes Patcher match property names case-insensitively like
+// encoding/json does. An exact match is still preferred.
+func CaseInsensitive() Option {
+	return func(p *Patcher) {
+		p.fold = true
+	}
+}
+
+// OnAlias registers fn that is called with the alias and the property name
+// whenever input uses an alias declared by the "alias" option of patch tag.
+// It helps to find clients still sending deprecated property names.
+func OnAlias(fn func(alias, prop string)) Option {
+	return func(p *Patcher) {
+		p.onAlias = fn
+	}
+}
+
+// UnknownPolicy describes how Patcher treats properties that don't match any
+// struct field.
+type UnknownPolicy int
+
+const (
+	// RejectUnknown makes parsing fail with an unexpected field error.
+	RejectUnknown UnknownPolicy = iota
+	// IgnoreUnknown skips unknown properties. Their names are listed in
+	// Result.Unknown.
+	IgnoreUnknown
+	// CollectUnknown collects raw values of unknown properties into
+	// Result.Extra.
+	CollectUnknown
+)
+
+// Unknown sets the policy for properties that don't match any struct field.
+// The default is RejectUnknown.
+func Unknown(policy UnknownPolicy) Option {
+	return func(p *Patcher) {
+		p.unknownPolicy = policy
+	}
+}
+
+// MaxBytes limits the size of input in bytes. Exceeding input fails with
+// ErrTooLarge.
+func MaxBytes(n int64) Option {
+	return func(p *Patcher) {
+		p.maxBytes = n
+	}
+}
+
+// MaxKeys limits the number of properties including unknown ones. Exceeding
+// input fails with ErrTooManyKeys.
+func MaxKeys(n int) Option {
+	return func(p *Patcher) {
+		p.maxKeys = n
+	}
+}
+
+// MaxStringLength limits the length of every string in values, which is
+// measured in bytes as encoded in JSON. Exceeding input fails with
+// ErrStringTooLong.
+func MaxStringLength(n int) Option {
+	return func(p *Patcher) {
+		p.maxString = n
+	}
+}
+
+// MaxDepth limits nesting depth of objects and arrays, where the top-level
+// object is depth 1. Exceeding input fails with ErrTooDeep.
+func MaxDepth(n int) Option {
+	return func(p *Patcher) {
+		p.maxDepth = n
+	}
+}
+
+// Limits describes the limits set by MaxBytes, MaxKeys, MaxStringLength and
+// MaxDepth. Zero means unlimited.
+type Limits struct {
+	MaxBytes        int64
+	MaxKeys         int
+	MaxStringLength int
+	MaxDepth        int
+}
+
+// Limits returns the limits of p so that a Decoder can enforce them. Parse
+// enforces MaxKeys by itself.
+func (p *Patcher) Limits() Limits {
+	return Limits{p.maxBytes, p.maxKeys, p.maxString, p.maxDepth}
+}
@@ -5,20 +5,25 @@ import (
 	"errors"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
 var (
-	// errNoInput represents an error for empty JSON input
-	errNoInput = errors.New("input is an empty JSON")
+	// errNoInput represents an error for input without properties
+	errNoInput = errors.New("input is empty")
 	// errInvalidJSONFormat describes that JSON format is invalid
 	errInvalidJSONFormat = errors.New("invalid JSON format")
 	// errUnexpectedField describes unknow field name
 	errUnexpectedField = errors.New("unexpected field")
 	// unmarshalling field failed
 	errUnmarshalField = errors.New("cannot unmarshal field")
+	// errDuplicateKey describes that the same property appears twice
+	errDuplicateKey = errors.New("duplicate key")
+	// errInvalidValue describes that a transform rejected the value
+	errInvalidValue = errors.New("invalid value")
 )
 
 // ParseError describes an error for parsing JSON input
@@ -29,6 +34,13 @@ type ParseError struct {
 	err error
 	// original error message
 	detail string
+	// input byte offset where the error occurred
+	Offset int64
+}
+
+// Unwrap returns the reason of the error such as ErrTooLarge.
+func (e *ParseError) Unwrap() error {
+	return e.err
 }
 
 // Error implements error interface.
@@ -43,11 +55,15 @@ func (e *ParseError) Error() string {
 	if e.detail != "" {
 		s += ", " + e.detail
 	}
+	if e.Offset != 0 {
+		s += " (offset " + strconv.FormatInt(e.Offset, 10) + ")"
+	}
 	return s
 }
 
-// newField parses reflect.StructField to set of structField and json property
-func parseField(v reflect.StructField) (name, propName string, ok bool) {
+// parseField parses reflect.StructField to set of column name, json property
+// name and options of patch tag.
+func parseField(v reflect.StructField) (name, propName string, opts []string, ok bool) {
 	if r, _ := utf8.DecodeRuneInString(v.Name); !unicode.IsUpper(r) {
 		return
 	}
@@ -62,7 +78,7 @@ func parseField(v reflect.StructField) (name, propName string, ok bool) {
 		propName = v.Name
 	}
 
-	name = v.Tag.Get("patch")
+	name, opts = splitPatchTag(v.Tag.Get("patch"))
 	if name == "-" {
 		return
 	}
@@ -70,30 +86,167 @@ func parseField(v reflect.StructField) (name, propName string, ok bool) {
 		name = propName
 	}
 
-	return name, propName, true
+	return name, propName, opts, true
+}
+
+// jsonOptions are options of json tag that Patcher works well with.
+var jsonOptions = map[string]bool{
+	"omitempty": true,
+	"omitzero":  true,
+}
+
+// checkField returns problems of the given struct field.
+func checkField(v reflect.StructField) (problems []string) {
+	_, opts := splitTag(v.Tag.Get("json"))
+	for _, opt := range opts {
+		if !jsonOptions[opt] {
+			problems = append(problems, "unsupported json option '"+opt+"'")
+		}
+	}
+	if !decodable(v.Type, make(map[reflect.Type]bool)) {
+		problems = append(problems, "type "+v.Type.String()+" cannot be decoded from JSON")
+	}
+	return problems
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// decodable reports whether encoding/json can decode a value to typ.
+func decodable(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[typ] || reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return true
+	}
+	seen[typ] = true
+	switch typ.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128,
+		reflect.UnsafePointer:
+		return false
+	case reflect.Interface:
+		// only empty interfaces can hold decoded values
+		return typ.NumMethod() == 0
+	case reflect.Map:
+		switch typ.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !reflect.PtrTo(typ.Key()).Implements(textUnmarshalerType) {
+				return false
+			}
+		}
+		return decodable(typ.Elem(), seen)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return decodable(typ.Elem(), seen)
+	}
+	return true
 }
 
 // structField
 type structField struct {
 	// name of the field.
 	name string
+	// JSON property name of the field
+	prop string
 	typ  reflect.Type
 	// index of struct field
 	index int
+	// legacy property names of the field
+	aliases []string
+	// normalizers declared by patch tag options
+	normalizers []normalizer
+	// whether null resets the field by the default option
+	resettable bool
+	// value that null resets the field to
+	reset interface{}
+	// integer map key of CBOR input declared by the cbor option
+	cborKey    int64
+	hasCBORKey bool
 }
 
-// unmarshal takes the given bytes to its type.
-func (f *structField) unmarshal(b []byte) (interface{}, error) {
-	v := reflect.New(f.typ)
-	if err := json.Unmarshal(b, v.Interface()); err != nil {
-		return nil, err
+// decodeField decodes the current value of d to the type of f and applies
+// normalizers and transforms. It prefers the registered DecodeFunc to
+// reflection. A null of a field declaring a default resets the field.
+func (p *Patcher) decodeField(f *structField, d valueDecoder) (interface{}, error) {
+	var v interface{}
+	if f.resettable {
+		// decode to a pointer to tell null from the zero value
+		rv := reflect.New(reflect.PtrTo(f.typ))
+		if err := d.decode(rv.Interface()); err != nil {
+			return nil, err
+		}
+		if rv.Elem().IsNil() {
+			return f.reset, nil
+		}
+		v = rv.Elem().Elem().Interface()
+	} else if p.decode != nil {
+		var err error
+		if v, err = p.decode(f.prop, d.decode); err != nil {
+			return nil, err
+		}
+	} else {
+		rv := reflect.New(f.typ)
+		if err := d.decode(rv.Interface()); err != nil {
+			return nil, err
+		}
+		v = rv.Elem().Interface()
+	}
+	v = f.normalize(v)
+	for _, fn := range p.transforms[f.name] {
+		var err error
+		if v, err = fn(v); err != nil {
+			return nil, &ParseError{err: errInvalidValue, detail: err.Error(), Offset: d.offset()}
+		}
 	}
-	return v.Elem().Interface(), nil
+	return v, nil
 }
 
 // Patcher is a json parser that takes fileds partially.
+// A Patcher is safe for concurrent use by multiple goroutines.
 type Patcher struct {
+	typ    reflect.Type
 	fields map[string]*structField
+	// fields in order of struct field index
+	sorted []*structField
+	// fields keyed by their aliases
+	aliases map[string]*structField
+	// properties keyed by integer map keys of CBOR input
+	cborKeys   map[int64]string
+	decode     DecodeFunc
+	duplicates duplicatePolicy
+	// whether property names are matched case-insensitively
+	fold bool
+	// called when an alias is used
+	onAlias func(alias, prop string)
+	// how properties that don't match any struct field are treated
+	unknownPolicy UnknownPolicy
+	limits
+	// struct field indexes that are excluded by Only or Except
+	hidden map[int]bool
+	// cross-field constraints
+	constraints []constraint
+	// transforms registered by Transform keyed by column name
+	transforms map[string][]func(interface{}) (interface{}, error)
+}
+
+// duplicatePolicy describes how Patcher treats duplicate properties.
+type duplicatePolicy int
+
+const (
+	// the last value wins
+	allowDuplicates duplicatePolicy = iota
+	// reject the same property names
+	rejectDuplicates
+	// reject property names that are equal under Unicode case-folding
+	rejectFoldedDuplicates
+)
+
+// isDuplicate reports whether prop is a duplicate of the given properties.
+func (d duplicatePolicy) isDuplicate(seen []string, prop string) bool {
+	for _, s := range seen {
+		if s == prop || d == rejectFoldedDuplicates && strings.EqualFold(s, prop) {
+			return true
+		}
+	}
+	return false
 }
 
 // trimCommaLeft omits strings after ","
@@ -105,75 +258,413 @@ func trimCommaLeft(s string) string {
 	return s
 }
 
-// parseStruct parse struct fields.
-func parseStruct(src interface{}) map[string]*structField {
+// splitTag splits a struct tag value to its name and options.
+func splitTag(s string) (name string, opts []string) {
+	parts := strings.Split(s, ",")
+	return parts[0], parts[1:]
+}
+
+// splitPatchTag is like splitTag but an option value in single quotes, like
+// default='["a","b"]', may contain commas.
+func splitPatchTag(s string) (name string, opts []string) {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted:
+			if s[i] == '\'' && (i+1 == len(s) || s[i+1] == ',') {
+				quoted = false
+			}
+		case s[i] == '\'' && i > 0 && s[i-1] == '=':
+			quoted = true
+		case s[i] == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+	return parts[0], parts[1:]
+}
+
+// splitOption splits an option of patch tag like "alias=name" to its key and
+// value. Single quotes around the value are removed.
+func splitOption(opt string) (key, value string) {
+	i := strings.IndexRune(opt, '=')
+	if i == -1 {
+		return opt, ""
+	}
+	key, value = opt[:i], opt[i+1:]
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
+
+// parseOptions applies options of patch tag to the field and returns
+// problems of them.
+func (f *structField) parseOptions(opts []string) (problems []string) {
+	for _, opt := range opts {
+		key, value := splitOption(opt)
+		switch key {
+		case "alias":
+			if value == "" {
+				problems = append(problems, "empty alias")
+				continue
+			}
+			f.aliases = append(f.aliases, value)
+		case "default":
+			v, err := parseDefault(opt, value, f.typ)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			f.resettable, f.reset = true, v
+		case "cbor":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				problems = append(problems, "invalid cbor key '"+value+"'")
+				continue
+			}
+			f.cborKey, f.hasCBORKey = n, true
+		default:
+			if isNormalizer(key) {
+				n, err := newNormalizer(key, value, f.typ)
+				if err != nil {
+					problems = append(problems, err.Error())
+					continue
+				}
+				f.normalizers = append(f.normalizers, n)
+				continue
+			}
+			problems = append(problems, "unsupported patch option '"+opt+"'")
+		}
+	}
+	return problems
+}
+
+// StructError describes problems of a struct that Compile found.
+type StructError struct {
+	// name of the struct type
+	Type string
+	// all the problems of the struct
+	Problems []string
+}
+
+// Error implements error interface.
+func (e *StructError) Error() string {
+	return "patch: invalid struct " + e.Type + ": " + strings.Join(e.Problems, "; ")
+}
+
+// structType returns the struct type of src.
+func structType(src interface{}) (reflect.Type, error) {
 	typ := reflect.TypeOf(src)
+	if typ == nil {
+		return nil, errors.New("patch: src should be a struct. But nil is given")
+	}
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
 	if typ.Kind() != reflect.Struct {
-		panic("patch: src should be a struct. But " + typ.Kind().String() + " is given")
+		return nil, errors.New("patch: src should be a struct. But " + typ.Kind().String() + " is given")
+	}
+	return typ, nil
+}
+
+// parseStruct parse struct fields. It returns all the problems of the struct
+// fields as well.
+func parseStruct(typ reflect.Type) *structInfo {
+	info := &structInfo{
+		fields:  make(map[string]*structField),
+		aliases: make(map[string]*structField),
 	}
-	fields := make(map[string]*structField)
+	columns := make(map[string]string)
+	props := make(map[string]string)
 	for i := 0; i < typ.NumField(); i++ {
 		v := typ.Field(i)
-		name, propName, ok := parseField(v)
-		if ok {
-			fields[propName] = &structField{
-				name:  name,
-				typ:   v.Type,
-				index: i,
+		name, propName, opts, ok := parseField(v)
+		if !ok {
+			continue
+		}
+		f := &structField{
+			name:  name,
+			prop:  propName,
+			typ:   v.Type,
+			index: i,
+		}
+		var errs []string
+		if other, dup := props[propName]; dup {
+			errs = append(errs, "duplicate property name '"+propName+"' with field "+other)
+		}
+		if other, dup := columns[name]; dup {
+			errs = append(errs, "duplicate column name '"+name+"' with field "+other)
+		}
+		errs = append(errs, checkField(v)...)
+		errs = append(errs, f.parseOptions(opts)...)
+		for _, err := range errs {
+			info.problems = append(info.problems, "field "+v.Name+": "+err)
+		}
+		props[propName] = v.Name
+		columns[name] = v.Name
+		info.fields[propName] = f
+		info.sorted = append(info.sorted, f)
+	}
+	for _, f := range info.sorted {
+		fieldName := typ.Field(f.index).Name
+		for _, alias := range f.aliases {
+			other, dup := props[alias]
+			if !dup {
+				if a, ok := info.aliases[alias]; ok {
+					other, dup = typ.Field(a.index).Name, true
+				}
+			}
+			if dup {
+				info.problems = append(info.problems, "field "+fieldName+": alias '"+alias+"' conflicts with field "+other)
+				continue
 			}
+			info.aliases[alias] = f
+		}
+		if f.hasCBORKey {
+			if other, dup := info.cborKeys[f.cborKey]; dup {
+				info.problems = append(info.problems, "field "+fieldName+": cbor key "+
+					strconv.FormatInt(f.cborKey, 10)+" conflicts with field "+typ.Field(info.fields[other].index).Name)
+				continue
+			}
+			if info.cborKeys == nil {
+				info.cborKeys = make(map[int64]string)
+			}
+			info.cborKeys[f.cborKey] = f.prop
 		}
 	}
-	return fields
+	return info
 }
 
-// New returns a pointer of Patcher with the given struct value.
-// It panics when type of src isn't struct or pointer of struct.
-func New(src interface{}) *Patcher {
-	return &Patcher{parseStruct(src)}
+// Compile returns a pointer of Patcher with the given struct value and
+// options. It returns an error when type of src isn't struct or pointer of
+// struct, and a *StructError listing all the problems of struct tags.
+func Compile(src interface{}, opts ...Option) (*Patcher, error) {
+	typ, err := structType(src)
+	if err != nil {
+		return nil, err
+	}
+	info := cachedStruct(typ)
+	if len(info.problems) != 0 {
+		return nil, &StructError{Type: typ.String(), Problems: info.problems}
+	}
+	p := &Patcher{
+		typ:      typ,
+		fields:   info.fields,
+		sorted:   info.sorted,
+		aliases:  info.aliases,
+		cborKeys: info.cborKeys,
+		decode:   lookupDecoder(typ),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if problems := p.optionProblems(); len(problems) != 0 {
+		return nil, &StructError{Type: typ.String(), Problems: problems}
+	}
+	return p, nil
+}
+
+// New is like Compile but panics when the struct cannot be compiled.
+// Struct types are compiled once and cached, so it is cheap to call New with
+// the same type per request.
+func New(src interface{}, opts ...Option) *Patcher {
+	p, err := Compile(src, opts...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return p
 }
 
 // Unmarshal unmarshal the given bytes to Fields that is sorted in order of
 // struct index.
 func (p *Patcher) Unmarshal(src []byte) (Fields, error) {
-	v := make(map[string]json.RawMessage)
-	if err := json.Unmarshal(src, &v); err != nil {
-		return nil, &ParseError{err: errInvalidJSONFormat, detail: err.Error()}
-	}
-	return p.parseFields(v)
+	return fieldsOf(p.UnmarshalResult(src))
 }
 
 // Decode decodes the given read stream to Fields.
 func (p *Patcher) Decode(r io.Reader) (Fields, error) {
-	v := make(map[string]json.RawMessage)
-	if err := json.NewDecoder(r).Decode(&v); err != nil {
-		return nil, &ParseError{err: errInvalidJSONFormat, detail: err.Error()}
-	}
-	return p.parseFields(v)
+	return fieldsOf(p.DecodeResult(r))
 }
 
-// parseFields parses the given map of json.RawMessages to values looking up
-// Patcher's pre-parsed types.
-func (p *Patcher) parseFields(values map[string]json.RawMessage) (Fields, error) {
-	if len(values) == 0 {
+// fieldsOf returns Fields of res. Input only with unknown properties fails
+// because they are dropped.
+func fieldsOf(res *Result, err error) (Fields, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Fields) == 0 {
 		return nil, &ParseError{err: errNoInput}
 	}
-	var i int
-	data := make(Fields, len(values))
-	for prop, msg := range values {
-		f, ok := p.fields[prop]
+	return res.Fields, nil
+}
+
+// Result is Fields along with properties that didn't match any struct field.
+type Result struct {
+	Fields
+	// Unknown lists properties that are ignored or collected because they
+	// didn't match any struct field, in order of appearance.
+	Unknown []string
+	// Extra holds raw values of unknown properties collected by
+	// CollectUnknown policy.
+	Extra map[string]json.RawMessage
+}
+
+// UnmarshalResult is like Unmarshal but returns *Result that describes
+// unknown properties as well. Input only with unknown properties gives an
+// empty Fields rather than an error.
+func (p *Patcher) UnmarshalResult(src []byte) (*Result, error) {
+	if p.maxBytes > 0 && int64(len(src)) > p.maxBytes {
+		return nil, &ParseError{err: ErrTooLarge}
+	}
+	return p.parseFields(&bytesDecoder{buf: src, props: p.fields, limits: p.limits})
+}
+
+// DecodeResult is like Decode but returns *Result that describes unknown
+// properties as well.
+func (p *Patcher) DecodeResult(r io.Reader) (*Result, error) {
+	return p.parseFields(newJSONDecoder(r, p.limits))
+}
+
+// Parse reads properties from d and decodes them to Fields.
+func (p *Patcher) Parse(d Decoder) (Fields, error) {
+	return fieldsOf(p.ParseResult(d))
+}
+
+// ParseResult is like Parse but returns *Result that describes unknown
+// properties as well.
+func (p *Patcher) ParseResult(d Decoder) (*Result, error) {
+	return p.parseFields(externalDecoder{d})
+}
+
+// lookup returns the struct field of the property prop. An exact match of
+// property names is preferred to aliases and case-insensitive matches.
+func (p *Patcher) lookup(prop string) (*structField, bool) {
+	if f, ok := p.fields[prop]; ok && p.visible(f) {
+		return f, true
+	}
+	if f, ok := p.aliases[prop]; ok && p.visible(f) {
+		p.aliasUsed(prop, f)
+		return f, true
+	}
+	if !p.fold {
+		return nil, false
+	}
+	for _, f := range p.sorted {
+		if strings.EqualFold(f.prop, prop) && p.visible(f) {
+			return f, true
+		}
+	}
+	for _, f := range p.sorted {
+		for _, alias := range f.aliases {
+			if strings.EqualFold(alias, prop) && p.visible(f) {
+				p.aliasUsed(alias, f)
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// aliasUsed notifies that the alias of f is used.
+func (p *Patcher) aliasUsed(alias string, f *structField) {
+	if p.onAlias != nil {
+		p.onAlias(alias, f.prop)
+	}
+}
+
+// parseFields reads properties from the given valueDecoder and decodes the
+// values directly to types of Patcher's pre-parsed fields. The last value
+// wins when the same property appears twice unless DisallowDuplicates is
+// given.
+func (p *Patcher) parseFields(d valueDecoder) (*Result, error) {
+	var data Fields
+	var seen []string
+	var keys int
+	res := new(Result)
+	for {
+		prop, err := d.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keys++; p.maxKeys > 0 && keys > p.maxKeys {
+			return nil, &ParseError{err: ErrTooManyKeys, Key: prop, Offset: d.offset()}
+		}
+		if p.duplicates != allowDuplicates {
+			if p.duplicates.isDuplicate(seen, prop) {
+				return nil, &ParseError{err: errDuplicateKey, Key: prop, Offset: d.offset()}
+			}
+			seen = append(seen, prop)
+		}
+		f, ok := p.lookup(prop)
 		if !ok {
-			return nil, &ParseError{err: errUnexpectedField, Key: prop}
+			if err := p.unknown(res, prop, d); err != nil {
+				return nil, err
+			}
+			continue
 		}
-		v, err := f.unmarshal(msg)
+		if p.duplicates != allowDuplicates && data.has(f.index) {
+			return nil, &ParseError{err: errDuplicateKey, Key: prop, Offset: d.offset()}
+		}
+		v, err := p.decodeField(f, d)
 		if err != nil {
-			return nil, &ParseError{err: errUnmarshalField, Key: prop, detail: err.Error()}
+			return nil, valueError(prop, err, d)
 		}
-		data[i] = Field{f.name, v, f.index}
-		i++
+		data = data.put(Field{f.name, v, f.index})
+	}
+	if len(data) == 0 && len(res.Unknown) == 0 {
+		return nil, &ParseError{err: errNoInput}
 	}
 	data.sort()
-	return data, nil
+	if err := p.checkConstraints(data); err != nil {
+		return nil, err
+	}
+	res.Fields = data
+	return res, nil
+}
+
+// valueError returns a *ParseError for the error of decoding the value of
+// the property prop.
+func valueError(prop string, err error, d valueDecoder) *ParseError {
+	if pErr, ok := err.(*ParseError); ok {
+		pErr.Key = prop
+		return pErr
+	}
+	return &ParseError{err: errUnmarshalField, Key: prop, detail: err.Error(), Offset: d.offset()}
+}
+
+// unknown handles the unknown property prop according to the policy of p.
+func (p *Patcher) unknown(res *Result, prop string, d valueDecoder) error {
+	if p.unknownPolicy == RejectUnknown {
+		return &ParseError{err: errUnexpectedField, Key: prop, Offset: d.offset()}
+	}
+	var raw json.RawMessage
+	if err := d.decode(&raw); err != nil {
+		return valueError(prop, err, d)
+	}
+	if !containsString(res.Unknown, prop) {
+		res.Unknown = append(res.Unknown, prop)
+	}
+	if p.unknownPolicy == CollectUnknown {
+		if res.Extra == nil {
+			res.Extra = make(map[string]json.RawMessage)
+		}
+		res.Extra[prop] = raw
+	}
+	return nil
+}
+
+// containsString reports whether s contains v.
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
 }
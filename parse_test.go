@@ -1,7 +1,10 @@
 package patch
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
@@ -230,3 +233,475 @@ func TestNewPatch(t *testing.T) {
 		}
 	}
 }
+
+func TestCompile(t *testing.T) {
+	type list []list
+	type valid struct {
+		ID    int               `json:"id,omitempty"`
+		Day   *Weekday          `json:"day" patch:"weekday"`
+		List  list              `json:"list"`
+		Ch    chan int          `json:"-"`
+		Fn    func()            `patch:"-"`
+		Days  []Weekday         `json:"days"`
+		Any   interface{}       `json:"any"`
+		Ints  map[int]string    `json:"ints"`
+		Times map[time.Time]int `json:"times"`
+		unexp complex64
+	}
+	if _, err := Compile(valid{}); err != nil {
+		t.Fatal(err)
+	}
+
+	type invalid struct {
+		ID     int
+		UserID int `json:"ID" patch:"user_id"`
+		Name   string
+		Title  string             `patch:"Name"`
+		Count  int                `json:"count,string"`
+		Memo   string             `patch:",unknown"`
+		Ch     chan int           `json:"ch"`
+		Values map[string]func()  `json:"values"`
+		Nums   []complex128       `json:"nums"`
+		Days   map[string]Weekday `json:"days"`
+		Reader io.Reader          `json:"reader"`
+		Pairs  map[[2]int]int     `json:"pairs"`
+	}
+	_, err := Compile(&invalid{})
+	sErr, ok := err.(*StructError)
+	if !ok {
+		t.Fatal("want *StructError: ", err)
+	}
+	expected := []string{
+		"field UserID: duplicate property name 'ID' with field ID",
+		"field Title: duplicate column name 'Name' with field Name",
+		"field Count: unsupported json option 'string'",
+		"field Memo: unsupported patch option 'unknown'",
+		"field Ch: type chan int cannot be decoded from JSON",
+		"field Values: type map[string]func() cannot be decoded from JSON",
+		"field Nums: type []complex128 cannot be decoded from JSON",
+		"field Reader: type io.Reader cannot be decoded from JSON",
+		"field Pairs: type map[[2]int]int cannot be decoded from JSON",
+	}
+	if !reflect.DeepEqual(sErr.Problems, expected) {
+		t.Fatalf("want %v, got %v", expected, sErr.Problems)
+	}
+
+	type cborKeys struct {
+		A int `json:"a" patch:",cbor=1"`
+		B int `json:"b" patch:",cbor=1"`
+		C int `json:"c" patch:",cbor=x"`
+		D int `json:"d" patch:",cbor=-2"`
+	}
+	_, err = Compile(cborKeys{})
+	if sErr, ok = err.(*StructError); !ok {
+		t.Fatal("want *StructError: ", err)
+	}
+	expected = []string{
+		"field C: invalid cbor key 'x'",
+		"field B: cbor key 1 conflicts with field A",
+	}
+	if !reflect.DeepEqual(sErr.Problems, expected) {
+		t.Fatalf("want %v, got %v", expected, sErr.Problems)
+	}
+	type device struct {
+		ID   string `json:"id" patch:",cbor=1"`
+		Temp int    `json:"temp" patch:",cbor=-2"`
+	}
+	p := New(device{})
+	if prop, ok := p.CBORKey(-2); !ok || prop != "temp" {
+		t.Fatal("Unexpected cbor key: ", prop, ok)
+	}
+	if _, ok := p.CBORKey(2); ok {
+		t.Fatal("cbor key 2 should not exist")
+	}
+
+	for _, src := range []interface{}{nil, 1, []invalid{}} {
+		if _, err := Compile(src); err == nil {
+			t.Fatal("should fail with: ", src)
+		}
+	}
+}
+
+func TestUnmarshalStream(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	p := New(user{})
+
+	f, err := p.Unmarshal([]byte(`{"name": "a", "id": 1, "name": "b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Fields{{"id", 1, 0}, {"name", "b", 1}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("want %v, got %v", expected, f)
+	}
+
+	testCases := []struct {
+		body   string
+		key    string
+		offset int64
+	}{
+		{`{"id": 1, "name": 2}`, "name", 19},
+		{`{"id": 1, "email": ""}`, "email", 17},
+		{`{"id": 1, "name": tru}`, "name", 22},
+		{`[1]`, "", 1},
+		{`{"id": 1} {}`, "", 11},
+	}
+	for i, tc := range testCases {
+		_, err := p.Unmarshal([]byte(tc.body))
+		pErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatal(i, ": want *ParseError: ", err)
+		}
+		if pErr.Key != tc.key {
+			t.Error(i, ": Unexpected Key: ", pErr.Key, " want ", tc.key)
+		}
+		if pErr.Offset != tc.offset {
+			t.Error(i, ": Unexpected Offset: ", pErr.Offset, " want ", tc.offset)
+		}
+	}
+}
+
+func TestUnmarshalSyntax(t *testing.T) {
+	type user struct {
+		Name string            `json:"name"`
+		Tags []string          `json:"tags"`
+		Meta map[string]string `json:"meta"`
+		Café string            `json:"café"`
+	}
+	p := New(user{})
+	f, err := p.Unmarshal([]byte(` { "n\u0061me" : "a\"}" ,"tags":["]", "{"],` +
+		`"meta": {"k": "}"}, "café": "x" } `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Fields{{"name", `a"}`, 0}, {"tags", []string{"]", "{"}, 1},
+		{"meta", map[string]string{"k": "}"}, 2}, {"café", "x", 3}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("want %v, got %v", expected, f)
+	}
+
+	for _, body := range []string{"", " ", "nul", `"a"`, `{"name"}`, `{"name": "a",}`,
+		`{"name": "a" "tags": []}`, `{name: "a"}`, `{"na` + "\n" + `me": 1`, `{"name": "a` + "\n\t" + `"}`,
+		`{"tags": ["a" "b"]}`, `{"tags": [}`, `{"name": -}`} {
+		if err := assertParseError(t, p, body); err.err != errInvalidJSONFormat && err.err != errUnmarshalField {
+			t.Errorf("Unexpected error for %q: %v", body, err)
+		}
+	}
+	if _, err := p.Unmarshal([]byte("null")); err.(*ParseError).err != errNoInput {
+		t.Fatal("Unexpected error: ", err)
+	}
+	if err := assertParseError(t, p, `{"tags": [1, x]}`); err.Offset != 14 || err.Key != "tags" {
+		t.Fatal("Unexpected error: ", err)
+	}
+	_, err = p.Unmarshal([]byte(`{"tags": [1, x]}`))
+	if pErr := err.(*ParseError); pErr.Offset != 14 || pErr.Key != "tags" {
+		t.Fatal("Unexpected error: ", err)
+	}
+}
+
+var benchBody = []byte(`{"id": 1, "name": "gopher", "email": "gopher@golang.org",
+	"active": true, "day": "friday", "days": ["monday", "friday"], "age": 10}`)
+
+func BenchmarkUnmarshal(b *testing.B) {
+	p := New(benchUser{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Unmarshal(benchBody); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkUnmarshalRawMap measures the former way that decodes the input to
+// map[string]json.RawMessage before decoding each value.
+func BenchmarkUnmarshalRawMap(b *testing.B) {
+	p := New(benchUser{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(benchBody, &m); err != nil {
+			b.Fatal(err)
+		}
+		data := make(Fields, 0, len(m))
+		for prop, msg := range m {
+			f := p.fields[prop]
+			v := reflect.New(f.typ)
+			if err := json.Unmarshal(msg, v.Interface()); err != nil {
+				b.Fatal(err)
+			}
+			data = append(data, Field{f.name, v.Elem().Interface(), f.index})
+		}
+		data.sort()
+	}
+}
+
+func TestDisallowDuplicates(t *testing.T) {
+	type user struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Role  string `json:"Role"`
+	}
+	testCases := []struct {
+		fold bool
+		body string
+		key  string
+	}{
+		{false, `{"name": "a", "email": "b", "name": "c"}`, "name"},
+		{true, `{"email": "a", "Email": "c"}`, "Email"},
+		{true, `{"Role": "user", "role": "admin"}`, "role"},
+	}
+	for i, tc := range testCases {
+		p := New(user{}, DisallowDuplicates(tc.fold))
+		err := assertParseError(t, p, tc.body)
+		if err.Key != tc.key {
+			t.Error(i, ": Unexpected Key: ", err.Key, " want ", tc.key)
+		}
+	}
+
+	p := New(user{}, DisallowDuplicates(true))
+	if _, err := p.Unmarshal([]byte(`{"name": "a", "email": "b"}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyMatching(t *testing.T) {
+	type user struct {
+		ID       int    `json:"id"`
+		UserName string `json:"username" patch:"user_name,alias=user_name,alias=login"`
+		Title    string `json:"title"`
+	}
+
+	var used []string
+	onAlias := OnAlias(func(alias, prop string) {
+		used = append(used, alias+">"+prop)
+	})
+	testCases := []struct {
+		opts []Option
+		body string
+		keys []string
+		err  bool
+	}{
+		{nil, `{"Title": "a"}`, nil, true},
+		{[]Option{CaseInsensitive()}, `{"Title": "a", "ID": 1}`, []string{"id", "title"}, false},
+		{[]Option{onAlias}, `{"user_name": "a"}`, []string{"user_name"}, false},
+		{[]Option{onAlias}, `{"User_Name": "a"}`, nil, true},
+		{[]Option{onAlias, CaseInsensitive()}, `{"LOGIN": "a"}`, []string{"user_name"}, false},
+		{[]Option{DisallowDuplicates(false)}, `{"username": "a", "login": "b"}`, nil, true},
+		{[]Option{CaseInsensitive(), DisallowDuplicates(false)}, `{"title": "a", "TITLE": "b"}`, nil, true},
+	}
+	for i, tc := range testCases {
+		p := New(user{}, tc.opts...)
+		f, err := p.Unmarshal([]byte(tc.body))
+		if tc.err {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatal(i, ": want *ParseError: ", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(i, ": ", err)
+		}
+		if !reflect.DeepEqual(f.Keys(), tc.keys) {
+			t.Fatalf("%d: want %v, got %v", i, tc.keys, f.Keys())
+		}
+	}
+	expected := []string{"user_name>username", "login>username"}
+	if !reflect.DeepEqual(used, expected) {
+		t.Fatalf("want %v, got %v", expected, used)
+	}
+
+	type conflict struct {
+		ID   int    `json:"id"`
+		Name string `json:"name" patch:",alias=id"`
+		Nick string `json:"nick" patch:",alias=n,alias="`
+		Nm   string `json:"nm" patch:",alias=n"`
+	}
+	_, err := Compile(conflict{})
+	sErr, ok := err.(*StructError)
+	if !ok {
+		t.Fatal("want *StructError: ", err)
+	}
+	problems := []string{
+		"field Nick: empty alias",
+		"field Name: alias 'id' conflicts with field ID",
+		"field Nm: alias 'n' conflicts with field Nick",
+	}
+	if !reflect.DeepEqual(sErr.Problems, problems) {
+		t.Fatalf("want %v, got %v", problems, sErr.Problems)
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	body := `{"name": "a", "nick": "b", "meta": {"x": [1, 2]}, "nick": "c"}`
+
+	assertParseError(t, New(user{}), body)
+
+	p := New(user{}, Unknown(IgnoreUnknown))
+	r, err := p.UnmarshalResult([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := r.Keys(); !reflect.DeepEqual(keys, []string{"name"}) {
+		t.Fatal("Unexpected keys: ", keys)
+	}
+	if !reflect.DeepEqual(r.Unknown, []string{"nick", "meta"}) {
+		t.Fatal("Unexpected unknown properties: ", r.Unknown)
+	}
+	if r.Extra != nil {
+		t.Fatal("should not collect: ", r.Extra)
+	}
+	r, err = p.UnmarshalResult([]byte(`{"extra": 1}`))
+	if err != nil || len(r.Fields) != 0 {
+		t.Fatal("should be empty: ", r, err)
+	}
+	if err := assertParseError(t, p, `{"extra": 1}`); err.err != errNoInput {
+		t.Fatal("Unexpected error: ", err)
+	}
+	_, err = p.UnmarshalForm(url.Values{"extra": {"1"}})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != errNoInput {
+		t.Fatal("Unexpected error: ", err)
+	}
+
+	p = New(user{}, Unknown(CollectUnknown))
+	r, err = p.DecodeResult(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := map[string]json.RawMessage{
+		"nick": json.RawMessage(`"c"`),
+		"meta": json.RawMessage(`{"x": [1, 2]}`),
+	}
+	if !reflect.DeepEqual(r.Extra, extra) {
+		t.Fatalf("want %s, got %s", extra, r.Extra)
+	}
+	r, err = p.UnmarshalResult([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Extra, extra) {
+		t.Fatalf("want %s, got %s", extra, r.Extra)
+	}
+	invalid := []struct {
+		body   string
+		offset int64
+	}{
+		{`{"name": "a", "nick": tru}`, 26},
+		{`{"x":[},"name":"a"}`, 7},
+		{`{"x":1e+-.,"name":"a"}`, 9},
+		{`{"x":{"a"},"name":"a"}`, 10},
+	}
+	for _, c := range invalid {
+		if err := assertParseError(t, p, c.body); err.err != errInvalidJSONFormat {
+			t.Fatal("Unexpected error: ", err)
+		}
+		_, err := p.UnmarshalResult([]byte(c.body))
+		if pErr, ok := err.(*ParseError); !ok || pErr.err != errInvalidJSONFormat || pErr.Offset != c.offset {
+			t.Fatalf("Unexpected error for %s: %v", c.body, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	type user struct {
+		Name string                 `json:"name"`
+		Tags []string               `json:"tags"`
+		Meta map[string]interface{} `json:"meta"`
+	}
+	testCases := []struct {
+		opt  Option
+		ok   string
+		ng   string
+		want error
+	}{
+		{MaxBytes(20), `{"name": "gopher"}`, `{"name": "gopher", "tags": []}`, ErrTooLarge},
+		{MaxKeys(2), `{"name": "a", "tags": []}`, `{"name": "a", "tags": [], "meta": {}}`, ErrTooManyKeys},
+		{MaxStringLength(3), `{"tags": ["abc"]}`, `{"tags": ["abc", "abcd"]}`, ErrStringTooLong},
+		{MaxStringLength(3), `{"meta": {"abc": 1}}`, `{"meta": {"abcd": 1}}`, ErrStringTooLong},
+		{MaxDepth(3), `{"meta": {"a": [1]}}`, `{"meta": {"a": [[1]]}}`, ErrTooDeep},
+	}
+	for i, tc := range testCases {
+		p := New(user{}, tc.opt)
+		if _, err := p.Unmarshal([]byte(tc.ok)); err != nil {
+			t.Fatal(i, ": ", err)
+		}
+		if _, err := p.Decode(strings.NewReader(tc.ok)); err != nil {
+			t.Fatal(i, ": ", err)
+		}
+		err := assertParseError(t, p, tc.ng)
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("%d: want %v, got %v", i, tc.want, err)
+		}
+		if _, err := p.Unmarshal([]byte(tc.ng)); !errors.Is(err, tc.want) {
+			t.Fatalf("%d: want %v, got %v", i, tc.want, err)
+		}
+	}
+
+	p := New(user{}, MaxStringLength(3), Unknown(CollectUnknown))
+	r, err := p.UnmarshalResult([]byte(`{"extra": [1]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Extra["extra"]) != "[1]" {
+		t.Fatal("Unexpected extra: ", r.Extra)
+	}
+	assertParseError(t, p, `{"extra": "long string"}`)
+}
+
+// pairDecoder is a Decoder of key-value pairs for testing.
+type pairDecoder struct {
+	pairs [][2]string
+	i     int
+}
+
+func (d *pairDecoder) Next() (string, error) {
+	if d.i == len(d.pairs) {
+		return "", io.EOF
+	}
+	d.i++
+	if d.pairs[d.i-1][0] == "" {
+		return "", errors.New("empty key")
+	}
+	return d.pairs[d.i-1][0], nil
+}
+
+func (d *pairDecoder) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(d.pairs[d.i-1][1]), v)
+}
+
+func (d *pairDecoder) InputOffset() int64 {
+	return int64(d.i)
+}
+
+func TestParse(t *testing.T) {
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	p := New(user{}, Unknown(CollectUnknown))
+	res, err := p.ParseResult(&pairDecoder{pairs: [][2]string{{"name", `"a"`}, {"id", "1"}, {"x", "true"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Fields, Fields{{"id", 1, 0}, {"name", "a", 1}}) {
+		t.Fatal("Unexpected fields: ", res.Fields)
+	}
+	if string(res.Extra["x"]) != "true" {
+		t.Fatal("Unexpected extra: ", res.Extra)
+	}
+
+	_, err = p.Parse(&pairDecoder{pairs: [][2]string{{"id", "1"}, {"", "2"}}})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != ErrInvalidFormat || pErr.Offset != 2 {
+		t.Fatal("Unexpected error: ", err)
+	}
+	_, err = p.Parse(&pairDecoder{pairs: [][2]string{{"id", `"1"`}}})
+	if pErr, ok := err.(*ParseError); !ok || pErr.err != errUnmarshalField || pErr.Key != "id" {
+		t.Fatal("Unexpected error: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Code generated by patchgen. DO NOT EDIT.
+
+package patch_test
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/smagch/patch"
+)
+
+func init() {
+	patch.Register(genUser{}, patchDecodeGenUser)
+}
+
+// patchDecodeGenUser decodes a JSON property of genUser without reflection.
+func patchDecodeGenUser(prop string, decode func(interface{}) error) (interface{}, error) {
+	switch prop {
+	case "ID":
+		var v int
+		err := decode(&v)
+		return v, err
+	case "name":
+		var v string
+		err := decode(&v)
+		return v, err
+	case "email":
+		var v string
+		err := decode(&v)
+		return v, err
+	case "Active":
+		var v bool
+		err := decode(&v)
+		return v, err
+	case "created":
+		var v time.Time
+		err := decode(&v)
+		return v, err
+	case "timeout":
+		var v *time.Duration
+		err := decode(&v)
+		return v, err
+	case "tags":
+		var v []string
+		err := decode(&v)
+		return v, err
+	case "meta":
+		var v map[string]string
+		err := decode(&v)
+		return v, err
+	}
+	return nil, errors.New("patch: unknown property " + strconv.Quote(prop))
+}
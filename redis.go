@@ -0,0 +1,112 @@
+package patch
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// RedisEncoder encodes a field value as a value of Redis hash.
+type RedisEncoder func(v interface{}) (string, error)
+
+// EncodeRedisValue is the default RedisEncoder. Strings and numbers are
+// formatted as they are, bools are "1" or "0", time.Time is in RFC 3339
+// format, encoding.TextMarshaler is used if implemented and other values are
+// encoded as JSON. Pointers are dereferenced and nil is "null" as in JSON.
+func EncodeRedisValue(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "null", nil
+	}
+	switch v := v.(type) {
+	case []byte:
+		return string(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		return string(b), err
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	case reflect.Ptr:
+		return EncodeRedisValue(rv.Elem().Interface())
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Redis provides a way to build commands that update a Redis hash.
+type Redis struct {
+	Fields
+	// Encoder encodes values of HSET. EncodeRedisValue is used if nil.
+	Encoder RedisEncoder
+}
+
+// Redis returns a Redis with the given Fields.
+func (f Fields) Redis() *Redis {
+	return &Redis{Fields: f}
+}
+
+// Commands returns commands for the hash key as argument slices that any
+// client can send, like ["HSET", key, "f1", "v1"]. Values are set by HSET,
+// null values and Default are deleted by HDEL, and Inc is written as HINCRBY
+// or HINCRBYFLOAT.
+func (r *Redis) Commands(key string) ([][]interface{}, error) {
+	encode := r.Encoder
+	if encode == nil {
+		encode = EncodeRedisValue
+	}
+	hset := []interface{}{"HSET", key}
+	hdel := []interface{}{"HDEL", key}
+	var incs [][]interface{}
+	for _, f := range r.Fields {
+		switch v := f.Value.(type) {
+		case keyword:
+			hdel = append(hdel, f.Key)
+		case Expr:
+			if v.op != opInc {
+				return nil, errors.New("patch: expression is not supported by Redis on key '" + f.Key + "'")
+			}
+			switch reflect.ValueOf(v.value).Kind() {
+			case reflect.Float32, reflect.Float64:
+				incs = append(incs, []interface{}{"HINCRBYFLOAT", key, f.Key, v.value})
+			default:
+				incs = append(incs, []interface{}{"HINCRBY", key, f.Key, v.value})
+			}
+		default:
+			if isNull(v) {
+				hdel = append(hdel, f.Key)
+				continue
+			}
+			s, err := encode(v)
+			if err != nil {
+				return nil, errors.New("patch: cannot encode value on key '" + f.Key + "', " + err.Error())
+			}
+			hset = append(hset, f.Key, s)
+		}
+	}
+	var commands [][]interface{}
+	if len(hset) > 2 {
+		commands = append(commands, hset)
+	}
+	if len(hdel) > 2 {
+		commands = append(commands, hdel)
+	}
+	return append(commands, incs...), nil
+}
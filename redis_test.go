@@ -0,0 +1,78 @@
+package patch
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedis(t *testing.T) {
+	f := Fields{
+		{"name", "gopher", 1},
+		{"age", 10, 2},
+		{"active", true, 3},
+		{"day", Friday, 4},
+		{"joined", time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC), 5},
+		{"tags", []string{"a"}, 6},
+		{"nickname", (*string)(nil), 7},
+		{"theme", Default, 8},
+		{"visits", Inc(1), 9},
+		{"score", Inc(0.5), 10},
+	}
+	commands, err := f.Redis().Commands("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]interface{}{
+		{"HSET", "user:1", "name", "gopher", "age", "10", "active", "1", "day", "5",
+			"joined", "2015-01-02T03:04:05Z", "tags", `["a"]`},
+		{"HDEL", "user:1", "nickname", "theme"},
+		{"HINCRBY", "user:1", "visits", 1},
+		{"HINCRBYFLOAT", "user:1", "score", 0.5},
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("want %v, got %v", expected, commands)
+	}
+
+	r := Fields{{"name", "gopher", 1}}.Redis()
+	r.Encoder = func(v interface{}) (string, error) {
+		return "<" + v.(string) + ">", nil
+	}
+	commands, err = r.Commands("user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := [][]interface{}{{"HSET", "user:1", "name", "<gopher>"}}; !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("want %v, got %v", expected, commands)
+	}
+
+	if _, err := (Fields{{"tags", Push("a"), 1}}).Redis().Commands("user:1"); err == nil {
+		t.Fatal("should fail with Push")
+	}
+}
+
+func TestEncodeRedisValue(t *testing.T) {
+	n := 3
+	testCases := []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{(*int)(nil), "null"},
+		{&n, "3"},
+		{(*time.Time)(nil), "null"},
+		{(*net.IP)(nil), "null"},
+		{net.IPv4(127, 0, 0, 1), "127.0.0.1"},
+		{[]byte("ab"), "ab"},
+	}
+	for _, tc := range testCases {
+		s, err := EncodeRedisValue(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != tc.expected {
+			t.Fatalf("want %s, got %s", tc.expected, s)
+		}
+	}
+}
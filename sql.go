@@ -2,7 +2,9 @@ package patch
 
 import (
 	"bytes"
+	"errors"
 	"strconv"
+	"strings"
 )
 
 // mergeArgs concat given three slice of interfaces.
@@ -29,38 +31,113 @@ func (s *SQL) Prepend(args ...interface{}) {
 	s.preArgs = append(s.preArgs, args...)
 }
 
-// Query returns pieace of SQL statement (key1=?,key2=?) and arguments appending
-// the given SQL arguments.
-func (s *SQL) Query(appends ...interface{}) (query string, args []interface{}) {
-	s.postArgs = append(s.postArgs, appends...)
-	var buf bytes.Buffer
-	values := make([]interface{}, len(s.Fields))
+// Convert converts values of the fields to driver values so that errors are
+// reported before the statement is executed. Registered converters are used
+// first, then driver.Valuer. Structs, maps, slices and arrays are encoded as
+// JSON for JSON columns, and other values are converted by
+// driver.DefaultParameterConverter. Fields that the SQL was created from are
+// left untouched.
+func (s *SQL) Convert() error {
+	fields := make(Fields, len(s.Fields))
 	for i, f := range s.Fields {
-		if i != 0 {
+		if err := unsupportedSQL(f); err != nil {
+			return &ConvertError{Key: f.Key, err: err}
+		}
+		switch v := f.Value.(type) {
+		case keyword:
+			fields[i] = f
+			continue
+		case Expr:
+			n, err := convertValue(v.value)
+			if err != nil {
+				return &ConvertError{Key: f.Key, err: err}
+			}
+			fields[i] = Field{f.Key, Inc(n), f.index}
+			continue
+		}
+		v, err := convertValue(f.Value)
+		if err != nil {
+			return &ConvertError{Key: f.Key, err: err}
+		}
+		fields[i] = Field{f.Key, v, f.index}
+	}
+	s.Fields = fields
+	return nil
+}
+
+// isNestedKey reports whether key is a nested path like "address.city",
+// which SQL would read as a column of another table.
+func isNestedKey(key string) bool {
+	return strings.ContainsRune(key, '.')
+}
+
+// unsupportedSQL returns an error if SQL can't update the field, such as a
+// nested path or an Expr other than Inc.
+func unsupportedSQL(f Field) error {
+	if isNestedKey(f.Key) {
+		return errors.New("nested path is not supported by SQL")
+	}
+	if e, ok := f.Value.(Expr); ok && e.op != opInc {
+		return errors.New("expression is not supported by SQL")
+	}
+	return nil
+}
+
+// setClause returns pieace of SQL statement with placeholders that
+// placeholder returns for the n-th value, and values for the placeholders.
+// It skips fields that unsupportedSQL reports, which Convert reports as
+// errors.
+func (s *SQL) setClause(placeholder func(n int) string) (string, []interface{}) {
+	var buf bytes.Buffer
+	values := make([]interface{}, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		if unsupportedSQL(f) != nil {
+			continue
+		}
+		if buf.Len() != 0 {
 			buf.WriteString(",")
 		}
 		buf.WriteString(f.Key)
-		buf.WriteString("=?")
-		values[i] = f.Value
+		buf.WriteString("=")
+		switch v := f.Value.(type) {
+		case keyword:
+			buf.WriteString(string(v))
+			continue
+		case Expr:
+			buf.WriteString(f.Key)
+			buf.WriteString("+")
+			buf.WriteString(placeholder(len(values)))
+			values = append(values, v.value)
+			continue
+		}
+		buf.WriteString(placeholder(len(values)))
+		values = append(values, f.Value)
 	}
-	return buf.String(), mergeArgs(s.preArgs, values, s.postArgs)
+	return buf.String(), values
+}
+
+// Query returns pieace of SQL statement (key1=?,key2=?) and arguments appending
+// the given SQL arguments. Default is written as key=DEFAULT, and Inc is
+// written as key=key+?. Other expressions such as Push and nested paths like
+// "address.city" of FromMask are skipped, and Convert reports them as errors
+// beforehand.
+func (s *SQL) Query(appends ...interface{}) (query string, args []interface{}) {
+	s.postArgs = append(s.postArgs, appends...)
+	query, values := s.setClause(func(n int) string {
+		return "?"
+	})
+	return query, mergeArgs(s.preArgs, values, s.postArgs)
 }
 
 // QueryPostgres returns pieace of SQL statement (key1=$1,key2=$2) and arguments
-// appending the given SQL arguments.
+// appending the given SQL arguments. Default is written as key=DEFAULT, and
+// Inc is written as key=key+$1. It skips other expressions and nested paths
+// as Query does.
 func (s *SQL) QueryPostgres(appends ...interface{}) (query string, args []interface{}) {
 	s.postArgs = append(s.postArgs, appends...)
-	var buf bytes.Buffer
 	offset := len(s.preArgs) + len(s.postArgs)
-	values := make([]interface{}, len(s.Fields))
-	for i, f := range s.Fields {
-		if i != 0 {
-			buf.WriteString(",")
-		}
-		buf.WriteString(f.Key)
-		buf.WriteString("=$")
-		buf.WriteString(strconv.Itoa(offset + i + 1))
-		values[i] = f.Value
-	}
-	return buf.String(), mergeArgs(s.preArgs, s.postArgs, values)
+	query, values := s.setClause(func(n int) string {
+		return "$" + strconv.Itoa(offset+n+1)
+	})
+	return query, mergeArgs(s.preArgs, s.postArgs, values)
 }
@@ -1,7 +1,9 @@
 package patch
 
 import (
+	"database/sql/driver"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -106,3 +108,119 @@ func TestQuery(t *testing.T) {
 		}
 	}
 }
+
+type point struct {
+	X, Y int
+}
+
+type upper string
+
+// Value implements driver.Valuer interface.
+func (u upper) Value() (driver.Value, error) {
+	return strings.ToUpper(string(u)), nil
+}
+
+type celsius float64
+
+func TestConvert(t *testing.T) {
+	RegisterConverter(celsius(0), func(v interface{}) (driver.Value, error) {
+		return float64(v.(celsius)) + 273.15, nil
+	})
+	num := 3
+	data := Fields{
+		{"day", Wednesday, 1},
+		{"point", point{1, 2}, 2},
+		{"tags", []string{"a", "b"}, 3},
+		{"meta", map[string]int{"a": 1}, 4},
+		{"name", upper("gopher"), 5},
+		{"temp", celsius(0), 6},
+		{"num", &num, 7},
+		{"nil", (*int)(nil), 8},
+		{"blob", []byte("raw"), 9},
+	}
+	s := data.SQL()
+	if err := s.Convert(); err != nil {
+		t.Fatal(err)
+	}
+	_, args := s.Query(1)
+	expected := []interface{}{
+		int64(3), `{"X":1,"Y":2}`, `["a","b"]`, `{"a":1}`, "GOPHER", 273.15,
+		int64(3), nil, []byte("raw"), 1,
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("want %#v, got %#v", expected, args)
+	}
+	if data[0].Value != Wednesday {
+		t.Fatal("should not modify original fields: ", data[0].Value)
+	}
+
+	s = Fields{{"ch", make(chan int), 1}}.SQL()
+	err := s.Convert()
+	cErr, ok := err.(*ConvertError)
+	if !ok {
+		t.Fatal("want *ConvertError: ", err)
+	}
+	if cErr.Key != "ch" {
+		t.Fatal("Unexpected Key: ", cErr.Key)
+	}
+}
+
+func TestQueryDefault(t *testing.T) {
+	data := Fields{
+		{"name", "golang", 1},
+		{"lang", Default, 2},
+		{"power", 100, 3},
+	}
+	s := data.SQL()
+	if err := s.Convert(); err != nil {
+		t.Fatal(err)
+	}
+	q, args := s.Query(1)
+	if q != "name=?,lang=DEFAULT,power=?" {
+		t.Fatal("Unexpected query: ", q)
+	}
+	if expected := []interface{}{"golang", int64(100), 1}; !reflect.DeepEqual(args, expected) {
+		t.Fatalf("want %v, got %v", expected, args)
+	}
+
+	s = data.SQL()
+	s.Prepend("foo")
+	q, args = s.QueryPostgres(1)
+	if q != "name=$3,lang=DEFAULT,power=$4" {
+		t.Fatal("Unexpected query: ", q)
+	}
+	if expected := []interface{}{"foo", 1, "golang", 100}; !reflect.DeepEqual(args, expected) {
+		t.Fatalf("want %v, got %v", expected, args)
+	}
+}
+
+func TestQueryExpr(t *testing.T) {
+	data := Fields{
+		{"name", "golang", 1},
+		{"visits", Inc(2), 2},
+	}
+	s := data.SQL()
+	if err := s.Convert(); err != nil {
+		t.Fatal(err)
+	}
+	q, args := s.QueryPostgres(1)
+	if q != "name=$2,visits=visits+$3" {
+		t.Fatal("Unexpected query: ", q)
+	}
+	if expected := []interface{}{1, "golang", int64(2)}; !reflect.DeepEqual(args, expected) {
+		t.Fatalf("want %v, got %v", expected, args)
+	}
+
+	s = Fields{{"tags", Push("a"), 1}, {"visits", Inc(1), 2}}.SQL()
+	if err, ok := s.Convert().(*ConvertError); !ok || err.Key != "tags" {
+		t.Fatal("should fail with Push: ", err)
+	}
+	q, args = s.Query(1)
+	if q != "visits=visits+?" || !reflect.DeepEqual(args, []interface{}{1, 1}) {
+		t.Fatal("Push should be skipped: ", q, args)
+	}
+	q, args = s.QueryPostgres()
+	if q != "visits=visits+$2" || !reflect.DeepEqual(args, []interface{}{1, 1}) {
+		t.Fatal("Push should be skipped: ", q, args)
+	}
+}
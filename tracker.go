@@ -0,0 +1,131 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// Tracker records changes of a struct value for building a PATCH request
+// body. Changes are the fields set by Set or Null and the fields that differ
+// from the snapshot taken by Track or Reset. The snapshot is a shallow copy,
+// so replace slices and maps rather than modifying them in place.
+type Tracker struct {
+	p *Patcher
+	// the tracked struct
+	v reflect.Value
+	// copy of the struct at Track or Reset
+	snapshot reflect.Value
+	// struct field indexes set by Set or Null
+	set map[int]bool
+	// struct field indexes set to null by Null
+	null map[int]bool
+}
+
+// Track returns a Tracker of the struct that ptr points to. Property names
+// and the fields allowed by Only or Except are the same as p. It panics when
+// ptr isn't a pointer to the struct type of p.
+func (p *Patcher) Track(ptr interface{}) *Tracker {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Type() != p.typ {
+		panic("patch: Track requires a non-nil pointer to " + p.typ.String())
+	}
+	t := &Tracker{p: p, v: rv.Elem()}
+	t.Reset()
+	return t
+}
+
+// Reset takes a new snapshot and forgets the fields set so far, typically
+// after the request succeeded.
+func (t *Tracker) Reset() {
+	t.snapshot = reflect.New(t.p.typ).Elem()
+	t.snapshot.Set(t.v)
+	t.set = make(map[int]bool)
+	t.null = make(map[int]bool)
+}
+
+// field returns the visible struct field of the property prop.
+func (t *Tracker) field(prop string) (*structField, error) {
+	f, ok := t.p.fields[prop]
+	if !ok || !t.p.visible(f) {
+		return nil, &ParseError{err: errUnexpectedField, Key: prop}
+	}
+	return f, nil
+}
+
+// Set sets v to the field of the property prop and records it as changed
+// even if the value is the same as before.
+func (t *Tracker) Set(prop string, v interface{}) error {
+	f, err := t.field(prop)
+	if err != nil {
+		return err
+	}
+	fv := t.v.Field(f.index)
+	if v == nil {
+		fv.Set(reflect.Zero(f.typ))
+	} else {
+		rv := reflect.ValueOf(v)
+		if !rv.Type().AssignableTo(f.typ) {
+			return errors.New("patch: " + rv.Type().String() + " is not assignable to " + f.typ.String() + " on key '" + prop + "'")
+		}
+		fv.Set(rv)
+	}
+	t.set[f.index] = true
+	delete(t.null, f.index)
+	return nil
+}
+
+// Null sets the zero value to the field of the property prop and records it
+// as an explicit null.
+func (t *Tracker) Null(prop string) error {
+	f, err := t.field(prop)
+	if err != nil {
+		return err
+	}
+	t.v.Field(f.index).Set(reflect.Zero(f.typ))
+	t.set[f.index] = true
+	t.null[f.index] = true
+	return nil
+}
+
+// Changes returns the changed fields in order of struct field index. Values
+// of fields set by Null are nil.
+func (t *Tracker) Changes() Fields {
+	f := t.p.diff(t.snapshot, t.v)
+	for _, sf := range t.p.sorted {
+		if t.set[sf.index] && t.p.visible(sf) {
+			f = f.put(Field{sf.name, t.v.Field(sf.index).Interface(), sf.index})
+		}
+		if t.null[sf.index] {
+			f = f.put(Field{sf.name, nil, sf.index})
+		}
+	}
+	f.sort()
+	return f
+}
+
+// MarshalJSON implements json.Marshaler interface. It encodes only the
+// changed fields keyed by their JSON property names.
+func (t *Tracker) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, data := range t.Changes() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		prop, err := json.Marshal(t.p.fieldByIndex(data.index).prop)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(data.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(prop)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	type user struct {
+		ID    int     `json:"id"`
+		Name  string  `json:"name"`
+		Email *string `json:"email" patch:"email_address"`
+		Age   int     `json:"age"`
+		Tags  []string
+	}
+	p := New(user{}).Except("id")
+	email := "a@example.com"
+	u := user{ID: 1, Name: "a", Email: &email}
+	tr := p.Track(&u)
+	if b, _ := tr.MarshalJSON(); string(b) != "{}" {
+		t.Fatal("Unexpected JSON: ", string(b))
+	}
+
+	u.Name = "b"
+	u.Tags = []string{"x"}
+	if err := tr.Set("age", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Null("email"); err != nil {
+		t.Fatal(err)
+	}
+	expected := Fields{{"name", "b", 1}, {"email_address", nil, 2}, {"age", 0, 3}, {"Tags", []string{"x"}, 4}}
+	if f := tr.Changes(); !reflect.DeepEqual(f, expected) {
+		t.Fatal("Unexpected changes: ", f)
+	}
+	b, err := tr.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"name":"b","email":null,"age":0,"Tags":["x"]}` {
+		t.Fatal("Unexpected JSON: ", s)
+	}
+	f, err := p.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := f.Keys(); !reflect.DeepEqual(keys, expected.Keys()) {
+		t.Fatal("Unexpected keys: ", keys)
+	}
+	if u.Email != nil {
+		t.Fatal("Null should set nil")
+	}
+
+	if err := tr.Set("email", &email); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tr.Changes().Get("email_address"); v != &email {
+		t.Fatal("Set should clear null: ", v)
+	}
+	tr.Reset()
+	if f := tr.Changes(); len(f) != 0 {
+		t.Fatal("Unexpected changes after Reset: ", f)
+	}
+
+	for _, err := range []error{tr.Set("id", 2), tr.Null("email_address"), tr.Set("age", "1")} {
+		if err == nil {
+			t.Fatal("should fail")
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic with a non-pointer")
+		}
+	}()
+	p.Track(u)
+}
@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package patch
+
+import (
+	"reflect"
+)
+
+// Typed is a Patcher that is bound to the struct type T.
+type Typed[T any] struct {
+	*Patcher
+}
+
+// NewTyped returns a pointer of Typed for the struct type T with the given
+// options. It panics when T isn't a struct.
+func NewTyped[T any](opts ...Option) *Typed[T] {
+	var src T
+	return &Typed[T]{New(&src, opts...)}
+}
+
+// Apply sets the given fields to dst.
+func (t *Typed[T]) Apply(dst *T, f Fields) error {
+	return t.apply(reflect.ValueOf(dst).Elem(), f)
+}
+
+// Diff returns fields whose values of b differ from a, in order of struct
+// field index.
+func (t *Typed[T]) Diff(a, b T) Fields {
+	return t.diff(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+// Key returns the column name of the field that sel points to.
+// It panics when sel doesn't return a pointer to a patchable field of T.
+func (t *Typed[T]) Key(sel func(*T) interface{}) string {
+	var src T
+	ptr := reflect.ValueOf(sel(&src))
+	rv := reflect.ValueOf(&src).Elem()
+	for _, sf := range t.sorted {
+		fv := rv.Field(sf.index)
+		if ptr.Kind() == reflect.Ptr && ptr.Pointer() == fv.Addr().Pointer() &&
+			ptr.Type().Elem() == fv.Type() {
+			return sf.name
+		}
+	}
+	panic("patch: selector doesn't point to a patchable field of " + rv.Type().String())
+}
+
+// Lookup returns a typed value of the field that sel points to.
+func Lookup[T, V any](t *Typed[T], f Fields, sel func(*T) *V) (V, bool) {
+	var v V
+	value, ok := f.Get(t.Key(func(src *T) interface{} { return sel(src) }))
+	if !ok {
+		return v, false
+	}
+	v, ok = value.(V)
+	return v, ok
+}
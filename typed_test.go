@@ -0,0 +1,67 @@
+//go:build go1.18
+// +build go1.18
+
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+type typedUser struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Email  string  `json:"email" patch:"email_address"`
+	Day    Weekday `json:"day"`
+	hidden int
+}
+
+func TestTyped(t *testing.T) {
+	p := NewTyped[typedUser]()
+	f, err := p.Unmarshal([]byte(`{"email": "@.org", "day": "friday"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email, ok := Lookup(p, f, func(u *typedUser) *string { return &u.Email })
+	if !ok || email != "@.org" {
+		t.Fatalf("want %v, got %v", "@.org", email)
+	}
+	day, ok := Lookup(p, f, func(u *typedUser) *Weekday { return &u.Day })
+	if !ok || day != Friday {
+		t.Fatalf("want %v, got %v", Friday, day)
+	}
+	if _, ok := Lookup(p, f, func(u *typedUser) *string { return &u.Name }); ok {
+		t.Fatal("should not be ok")
+	}
+
+	u := typedUser{ID: 1, Name: "gopher"}
+	if err := p.Apply(&u, f); err != nil {
+		t.Fatal(err)
+	}
+	expected := typedUser{ID: 1, Name: "gopher", Email: "@.org", Day: Friday}
+	if u != expected {
+		t.Fatalf("want %v, got %v", expected, u)
+	}
+
+	f.Set("name", 1)
+	if err := p.Apply(&u, f); err == nil {
+		t.Fatal("should fail to apply int to string")
+	}
+
+	diff := p.Diff(typedUser{ID: 1, Name: "a", Day: Monday}, typedUser{ID: 1, Name: "b", Email: "c"})
+	want := Fields{{"name", "b", 1}, {"email_address", "c", 2}, {"day", Weekday(0), 3}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("want %v, got %v", want, diff)
+	}
+}
+
+func TestTypedKeyPanic(t *testing.T) {
+	p := NewTyped[typedUser]()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic")
+		}
+	}()
+	p.Key(func(u *typedUser) interface{} { return &u.hidden })
+}
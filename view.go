@@ -0,0 +1,48 @@
+package patch
+
+// visible reports whether f isn't excluded by Only or Except.
+func (p *Patcher) visible(f *structField) bool {
+	return !p.hidden[f.index]
+}
+
+// restrict returns a copy of p that hides fields for which hide returns true
+// in addition to fields p already hides. It panics when props has a name
+// that isn't a property of the struct.
+func (p *Patcher) restrict(props []string, hide func(f *structField, listed bool) bool) *Patcher {
+	listed := make(map[int]bool)
+	for _, prop := range props {
+		f, ok := p.fields[prop]
+		if !ok {
+			panic("patch: unknown property '" + prop + "' of " + p.typ.String())
+		}
+		listed[f.index] = true
+	}
+	q := *p
+	q.hidden = make(map[int]bool)
+	for _, f := range p.sorted {
+		if p.hidden[f.index] || hide(f, listed[f.index]) {
+			q.hidden[f.index] = true
+		}
+	}
+	return &q
+}
+
+// Only returns a Patcher that accepts only the given JSON properties. Other
+// properties are treated as unknown ones. The returned Patcher shares the
+// compiled struct fields and options with p.
+// It panics when a name isn't a property of the struct.
+func (p *Patcher) Only(props ...string) *Patcher {
+	return p.restrict(props, func(f *structField, listed bool) bool {
+		return !listed
+	})
+}
+
+// Except returns a Patcher that doesn't accept the given JSON properties.
+// They are treated as unknown ones. The returned Patcher shares the compiled
+// struct fields and options with p.
+// It panics when a name isn't a property of the struct.
+func (p *Patcher) Except(props ...string) *Patcher {
+	return p.restrict(props, func(f *structField, listed bool) bool {
+		return listed
+	})
+}
@@ -0,0 +1,49 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOnlyExcept(t *testing.T) {
+	type user struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email" patch:"email_address"`
+		Role  string `json:"role"`
+	}
+	admin := New(user{}, CaseInsensitive())
+	self := admin.Only("name", "email", "role").Except("role")
+
+	if _, err := admin.Unmarshal([]byte(`{"role": "admin"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"role": "admin"}`, `{"ROLE": "admin"}`, `{"id": 1}`} {
+		err := assertParseError(t, self, body)
+		if err.err != errUnexpectedField {
+			t.Fatal("Unexpected error: ", err)
+		}
+	}
+	f, err := self.Unmarshal([]byte(`{"Name": "gopher", "email": "@"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := f.Keys(); !reflect.DeepEqual(keys, []string{"name", "email_address"}) {
+		t.Fatal("Unexpected keys: ", keys)
+	}
+	if reflect.ValueOf(self.fields).Pointer() != reflect.ValueOf(admin.fields).Pointer() {
+		t.Fatal("should share compiled fields")
+	}
+
+	diff := self.diff(reflect.ValueOf(user{}), reflect.ValueOf(user{1, "a", "b", "c"}))
+	if keys := diff.Keys(); !reflect.DeepEqual(keys, []string{"name", "email_address"}) {
+		t.Fatal("Unexpected diff keys: ", keys)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic with unknown property")
+		}
+	}()
+	admin.Only("email_address")
+}